@@ -0,0 +1,300 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Directions and outcomes of the events recorded in the migration log.
+const (
+	directionUp   = "up"
+	directionDown = "down"
+
+	outcomeSuccess = "success"
+	outcomeFailed  = "failed"
+)
+
+// logTableName returns the name of the table where every change of version
+// is appended, while the version table only holds the current one.
+func logTableName() string {
+	return tableName + "_log"
+}
+
+// logTable returns the name of the migration log table quoted for the
+// dialect of the given database.
+func logTable(db DB) (string, error) {
+	table, err := quoteIdent(dialectFor(db), logTableName())
+	if err != nil {
+		return "", fmt.Errorf("invalid migration log table name: %s", err)
+	}
+	return table, nil
+}
+
+const logTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	version bigint not null,
+	direction varchar(4) not null,
+	applied_at bigint not null,
+	outcome varchar(16) not null,
+	message varchar(255)
+)
+`
+
+// setupLog creates the migration log table if it does not exist. If the log
+// is empty but the version table is not, the version table still has the old
+// layout, with a row for every change of version, so its rows are moved to
+// the log leaving only the one of the current version. The rows are moved in
+// a single transaction while holding the migrations lock, so instances
+// starting at the same time don't move them twice.
+func setupLog(db DB) error {
+	table, err := logTable(db)
+	if err != nil {
+		return err
+	}
+
+	if err := createTable(db, fmt.Sprintf(logTableSQL, table), logTableName()); err != nil {
+		return err
+	}
+
+	legacy, err := hasLegacyRows(db)
+	if err != nil || !legacy {
+		return err
+	}
+
+	return withLockTx(db, func(db DB) error {
+		// another instance might have moved the rows while this one was
+		// waiting for the lock
+		legacy, err := hasLegacyRows(db)
+		if err != nil || !legacy {
+			return err
+		}
+
+		return migrateVersionRows(db)
+	})
+}
+
+// hasLegacyLayout reports whether the version table still has the old layout,
+// which is the case when the migration log does not exist, or when it's empty
+// but the version table is not. The version table must exist.
+func hasLegacyLayout(db DB) (bool, error) {
+	var count int
+	if err := db.QueryRow(tableExistsQuery(dialectFor(db), logTableName()), execModeArgs()...).Scan(&count); err != nil {
+		return false, fmt.Errorf("unable to check if table %s exists: %s", logTableName(), err)
+	}
+
+	if count == 0 {
+		return true, nil
+	}
+
+	return hasLegacyRows(db)
+}
+
+// hasLegacyRows reports whether the migration log, which must exist, is empty
+// but the version table is not, so the version table still has the old
+// layout.
+func hasLegacyRows(db DB) (bool, error) {
+	table, err := logTable(db)
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", table)
+	if err := db.QueryRow(query, execModeArgs()...).Scan(&count); err != nil {
+		return false, fmt.Errorf("unable to count rows of table %s: %s", logTableName(), err)
+	}
+
+	if count > 0 {
+		return false, nil
+	}
+
+	table, err = versionTable(db)
+	if err != nil {
+		return false, err
+	}
+
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s", table)
+	if err := db.QueryRow(query, execModeArgs()...).Scan(&count); err != nil {
+		return false, fmt.Errorf("unable to count rows of table %s: %s", tableName, err)
+	}
+
+	return count > 0, nil
+}
+
+type versionRow struct {
+	version   int64
+	updatedAt int64
+	message   sql.NullString
+}
+
+// migrateVersionRows copies all the rows of a version table with the old
+// layout to the migration log and deletes all of them but the one of the
+// current version, which is the highest version among the newest rows.
+func migrateVersionRows(db DB) error {
+	table, err := versionTable(db)
+	if err != nil {
+		return err
+	}
+
+	versions, err := readVersionRows(db)
+	if err != nil {
+		return err
+	}
+
+	var prev int64
+	for _, r := range versions {
+		if err := appendLog(db, r.version, direction(prev, r.version), outcomeSuccess, r.updatedAt, r.message.String); err != nil {
+			return err
+		}
+		prev = r.version
+	}
+
+	if len(versions) < 2 {
+		return nil
+	}
+
+	current := versions[len(versions)-1]
+	_, err = db.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE %s < %d OR (%s = %d AND %s <> %d)",
+		table, updatedAtColumn, current.updatedAt,
+		updatedAtColumn, current.updatedAt, versionColumn, current.version,
+	), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to delete old rows of table %s: %s", tableName, err)
+	}
+	return nil
+}
+
+// readVersionRows returns all the rows of a version table with the old
+// layout, from the oldest to the newest. Rows updated at the same time are
+// sorted by version.
+func readVersionRows(db DB) ([]versionRow, error) {
+	table, err := versionTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	// the message column was added to the version table before the log
+	// existed
+	message := "NULL"
+	if columns[messageColumn] {
+		message = messageColumn
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT %s, %s, %s FROM %s ORDER BY %s ASC",
+		versionColumn, updatedAtColumn, message, table, updatedAtColumn,
+	), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rows of table %s: %s", tableName, err)
+	}
+	defer rows.Close()
+
+	var versions []versionRow
+	for rows.Next() {
+		var r versionRow
+		if err := rows.Scan(&r.version, &r.updatedAt, &r.message); err != nil {
+			return nil, fmt.Errorf("unable to scan row of table %s: %s", tableName, err)
+		}
+		versions = append(versions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read rows of table %s: %s", tableName, err)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].updatedAt != versions[j].updatedAt {
+			return versions[i].updatedAt < versions[j].updatedAt
+		}
+		return compareVersions(versions[i].version, versions[j].version) < 0
+	})
+
+	return versions, nil
+}
+
+// direction returns the direction of a change from version from to version
+// to.
+func direction(from, to int64) string {
+	if compareVersions(to, from) < 0 {
+		return directionDown
+	}
+	return directionUp
+}
+
+// appendLog appends an event to the migration log.
+func appendLog(db DB, version int64, direction, outcome string, appliedAt int64, message string) error {
+	table, err := logTable(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(appendLogQuery(table, version, direction, outcome, appliedAt, message), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to record version %d in table %s: %s", version, logTableName(), err)
+	}
+	return nil
+}
+
+func appendLogQuery(table string, version int64, direction, outcome string, appliedAt int64, message string) string {
+	msg := "NULL"
+	if message != "" {
+		msg = quoteString(message)
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (version, direction, applied_at, outcome, message) VALUES (%d, %s, %d, %s, %s)",
+		table, version, quoteString(direction), appliedAt, quoteString(outcome), msg,
+	)
+}
+
+// logFailure records in the migration log that applying the migration with
+// the given version failed. The migration might have run inside a transaction
+// that was rolled back, so it is recorded outside of it. Since the failure is
+// already being reported, errors recording it are only logged.
+func logFailure(q Querier, version int64, direction string) {
+	if versionStore != nil {
+		return
+	}
+
+	err := withQuerier(q, func(db DB) error {
+		appliedAt, err := nextAppliedAt(db)
+		if err != nil {
+			return err
+		}
+
+		return appendLog(db, version, direction, outcomeFailed, appliedAt, runMessage)
+	})
+	if err != nil {
+		logger.Warnf("unable to record failure of migration %d: %s", version, err)
+	}
+}
+
+// nextAppliedAt returns the time to record the next event of the migration
+// log with. It must always increase, otherwise events recorded in the same
+// second would be impossible to tell apart.
+func nextAppliedAt(db DB) (int64, error) {
+	table, err := logTable(db)
+	if err != nil {
+		return 0, err
+	}
+
+	var last sql.NullInt64
+	query := fmt.Sprintf("SELECT MAX(applied_at) FROM %s", table)
+	if err := db.QueryRow(query, execModeArgs()...).Scan(&last); err != nil {
+		return 0, fmt.Errorf("unable to read last event of table %s: %s", logTableName(), err)
+	}
+
+	now := time.Now().Unix()
+	if last.Valid && last.Int64 >= now {
+		return last.Int64 + 1, nil
+	}
+	return now, nil
+}
@@ -0,0 +1,289 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetVersion_Log(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	migrations[2].up = newMigrationFunc(3, migrationUp, errors.New("boom"))
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting an error")
+	}
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "__version"`).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 1 {
+		t.Errorf("unexpected number of rows in version table:\n\t(GOT): %d\n\t(WNT): %d", count, 1)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var events [][3]interface{}
+	for _, r := range rows {
+		events = append(events, [3]interface{}{r.Version, r.Direction, r.Outcome})
+	}
+
+	expected := [][3]interface{}{
+		{int64(1), "up", "success"},
+		{int64(2), "up", "success"},
+		{int64(3), "up", "failed"},
+		{int64(1), "down", "success"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events:\n\t(GOT): %v\n\t(WNT): %v", events, expected)
+	}
+}
+
+func TestSetupLog_OldLayout(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`CREATE TABLE "__version" (version bigint not null, updated_at bigint not null, message varchar(255))`,
+		`INSERT INTO "__version" VALUES (1, 1000, NULL), (3, 2000, 'hotfix'), (2, 3000, NULL)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "__version"`).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 1 {
+		t.Errorf("unexpected number of rows in version table:\n\t(GOT): %d\n\t(WNT): %d", count, 1)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var events [][3]interface{}
+	for _, r := range rows {
+		events = append(events, [3]interface{}{r.Version, r.Direction, r.Message})
+	}
+
+	expected := [][3]interface{}{
+		{int64(1), "up", ""},
+		{int64(3), "up", "hotfix"},
+		{int64(2), "down", ""},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events:\n\t(GOT): %v\n\t(WNT): %v", events, expected)
+	}
+
+	// the rows are only moved once
+	if err := Init(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	history, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(history) != 3 {
+		t.Errorf("unexpected history length:\n\t(GOT): %d\n\t(WNT): %d", len(history), 3)
+	}
+}
+
+func TestSetupLog_OldLayoutTiedTimestamps(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`CREATE TABLE "__version" (version bigint not null, updated_at bigint not null)`,
+		`INSERT INTO "__version" VALUES (1, 1000), (3, 2000), (2, 2000)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Init(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var versions []int64
+	rows, err := db.Query(`SELECT version FROM "__version"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(versions, []int64{3}) {
+		t.Errorf("unexpected rows in version table:\n\t(GOT): %v\n\t(WNT): %v", versions, []int64{3})
+	}
+}
+
+func TestSetupLog_OldLayoutAtomic(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`CREATE TABLE "__version" (version bigint not null, updated_at bigint not null)`,
+		`INSERT INTO "__version" VALUES (1, 1000), (2, 2000), (3, 3000)`,
+		`CREATE TRIGGER fail_delete BEFORE DELETE ON "__version" BEGIN SELECT RAISE(ABORT, 'boom'); END`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Init(db); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	for table, expected := range map[string]int{`"__version"`: 3, `"__version_log"`: 0, `__version_lock`: 0} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if count != expected {
+			t.Errorf("unexpected number of rows in %s:\n\t(GOT): %d\n\t(WNT): %d", table, count, expected)
+		}
+	}
+}
+
+func TestHistory_OldLayoutReadOnly(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`CREATE TABLE "__version" (version bigint not null, updated_at bigint not null)`,
+		`INSERT INTO "__version" VALUES (1, 1000), (3, 2000), (2, 3000)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var events [][2]interface{}
+	for _, r := range rows {
+		events = append(events, [2]interface{}{r.Version, r.Direction})
+	}
+
+	expected := [][2]interface{}{{int64(1), "up"}, {int64(3), "up"}, {int64(2), "down"}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events:\n\t(GOT): %v\n\t(WNT): %v", events, expected)
+	}
+
+	history, err := HistorySince(db, time.Unix(2000, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(history) != 2 {
+		t.Errorf("unexpected history length:\n\t(GOT): %d\n\t(WNT): %d", len(history), 2)
+	}
+
+	var count int
+	if err := db.QueryRow(tableExistsQuery(SQLite, "__version_log")).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 0 {
+		t.Errorf("migration log was created by a read-only function")
+	}
+}
+
+func TestSetupLog_OldLayoutLockHeld(t *testing.T) {
+	defer SetLockTimeout(0)
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`CREATE TABLE "__version" (version bigint not null, updated_at bigint not null)`,
+		`INSERT INTO "__version" VALUES (1, 1000), (2, 2000)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	unlock, err := Lock(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer unlock()
+
+	// the rows are moved with the lock held by the caller instead of
+	// waiting for it
+	SetLockTimeout(100 * time.Millisecond)
+	if err := Init(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	history, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(history) != 2 {
+		t.Errorf("unexpected history length:\n\t(GOT): %d\n\t(WNT): %d", len(history), 2)
+	}
+}
@@ -0,0 +1,198 @@
+package mig
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned, wrapped along with the details, when
+// migrations that have already been applied changed since then.
+var ErrChecksumMismatch = errors.New("applied migrations changed after being applied")
+
+var allowDirty bool
+
+// SetAllowDirty sets whether migrations should be applied even if Verify finds
+// applied migrations that changed since they were applied, logging the
+// mismatches as a warning instead of failing. It is an escape hatch for when
+// an old migration was edited on purpose, e.g. to fix a typo in a comment.
+func SetAllowDirty(allow bool) {
+	allowDirty = allow
+}
+
+// checksum returns the checksum of the statements of the migration, or an
+// empty string if it was not loaded from SQL files, since the code of Go
+// migrations is not available once they are compiled.
+func (m migration) checksum() string {
+	if m.upSQL == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, stmts := range [][]string{m.upSQL, m.downSQL} {
+		for _, stmt := range stmts {
+			_, _ = h.Write([]byte(stmt))
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write([]byte{1})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hasChecksums returns whether any of the registered migrations has a
+// checksum.
+func hasChecksums() bool {
+	for _, m := range migrations {
+		if m.upSQL != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func checksumsTableName() string {
+	return tableName + "_checksums"
+}
+
+const checksumsTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	version bigint not null,
+	checksum varchar(64) not null
+)
+`
+
+func setupChecksums(db DB) error {
+	table, err := quoteTable(db, checksumsTableName())
+	if err != nil {
+		return err
+	}
+	return createTable(db, fmt.Sprintf(checksumsTableSQL, table), checksumsTableName())
+}
+
+// recordChecksum records the checksum of the given migration after applying
+// it, replacing the one recorded if it was applied before. Nothing is
+// recorded for migrations without a checksum.
+func recordChecksum(db DB, m migration) error {
+	sum := m.checksum()
+	if sum == "" {
+		return nil
+	}
+
+	table, err := quoteTable(db, checksumsTableName())
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE version = %d",
+		table, m.version,
+	), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to record checksum of migration %d: %s", m.version, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (version, checksum) VALUES (%d, %s)",
+		table, m.version, quoteString(sum),
+	), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to record checksum of migration %d: %s", m.version, err)
+	}
+	return nil
+}
+
+// readChecksums returns the checksums recorded for every version.
+func readChecksums(db DB) (map[int64]string, error) {
+	table, err := quoteTable(db, checksumsTableName())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT version, checksum FROM %s", table), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checksums: %s", err)
+	}
+	defer rows.Close()
+
+	var checksums = make(map[int64]string)
+	for rows.Next() {
+		var version int64
+		var sum string
+		if err := rows.Scan(&version, &sum); err != nil {
+			return nil, fmt.Errorf("unable to scan checksum: %s", err)
+		}
+		checksums[version] = sum
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read checksums: %s", err)
+	}
+
+	return checksums, nil
+}
+
+// Verify checks that the migrations loaded from SQL files that have already
+// been applied to the database did not change since then, comparing their
+// checksums with the ones recorded when they were applied. All the
+// migrations that changed are reported in a single error that wraps
+// ErrChecksumMismatch. Go migrations and migrations applied before their
+// checksum was recorded are not verified.
+func Verify(db *sql.DB) error {
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+
+	return withDatabase(db, func(db DB) error {
+		return verifyChecksums(db, current)
+	})
+}
+
+// verifyChecksums checks the checksums of the migrations applied up to the
+// given version. The checksums table must exist if there are migrations with
+// a checksum.
+func verifyChecksums(db DB, current int64) error {
+	if !hasChecksums() {
+		return nil
+	}
+
+	recorded, err := readChecksums(db)
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, current) > 0 {
+			continue
+		}
+
+		sum, ok := recorded[m.version]
+		if ok && m.checksum() != "" && sum != m.checksum() {
+			changed = append(changed, fmt.Sprintf("%d (%s)", m.version, m.file))
+		}
+	}
+
+	if len(changed) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// checkChecksums fails if migrations applied up to the given version changed
+// since they were applied, unless it was allowed with SetAllowDirty, in which
+// case the mismatch is only logged.
+func checkChecksums(q Querier, current int64) error {
+	err := withQuerier(q, func(db DB) error {
+		return verifyChecksums(db, current)
+	})
+
+	if err != nil && allowDirty && errors.Is(err, ErrChecksumMismatch) {
+		logger.Warnf("%s", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package mig
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVerify(t *testing.T) {
+	defer reset()
+	defer SetAllowDirty(false)
+
+	fsys := fstest.MapFS{
+		"1_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"1_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"2_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"2_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := ToVersion(db, true, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Verify(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(rows) != 1 || rows[0].Checksum != migrations[0].checksum() {
+		t.Errorf("expecting checksum of migration 1 in history, got: %v", rows)
+	}
+
+	// the applied migration is edited afterwards
+	migrations[0].upSQL = []string{"CREATE TABLE a (id bigint)"}
+
+	if err := Verify(db); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expecting checksum mismatch, got: %v", err)
+	}
+
+	if _, _, err := Up(db, true); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expecting checksum mismatch, got: %v", err)
+	}
+
+	if v, err := CurrentVersion(db); err != nil || v != 1 {
+		t.Errorf("unexpected version: %d, err: %v", v, err)
+	}
+
+	SetAllowDirty(true)
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v, err := CurrentVersion(db); err != nil || v != 2 {
+		t.Errorf("unexpected version: %d, err: %v", v, err)
+	}
+}
+
+func TestVerify_GoMigrations(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(2)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Verify(db); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if sum := migrations[0].checksum(); sum != "" {
+		t.Errorf("unexpected checksum for go migration: %s", sum)
+	}
+}
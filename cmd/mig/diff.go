@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/erizocosmico/mig"
+)
+
+// table is a table found in a schema dump.
+type table struct {
+	name string
+	// stmt is the statement that creates the table.
+	stmt    string
+	columns []column
+}
+
+type column struct {
+	name string
+	// def is the definition of the column, that is, its type and
+	// constraints.
+	def string
+}
+
+// column returns the column of the table with the given name, regardless of
+// whether the names are quoted or not.
+func (t *table) column(name string) (column, bool) {
+	for _, c := range t.columns {
+		if strings.EqualFold(unquoteIdent(c.name), unquoteIdent(name)) {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// schemaDiff returns the statements to go from the schema in the file from to
+// the one in the file to and back.
+func schemaDiff(from, to string) (up, down []string, err error) {
+	fromTables, err := parseSchemaFile(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toTables, err := parseSchemaFile(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	up, down = diffTables(fromTables, toTables)
+	return up, down, nil
+}
+
+func parseSchemaFile(path string) (map[string]*table, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema file %s: %s", path, err)
+	}
+
+	return parseSchema(string(content)), nil
+}
+
+// diffTables returns the statements to create and drop the tables and
+// columns that were added or removed in to compared to from. Changes in the
+// definition of existing columns are not detected.
+func diffTables(from, to map[string]*table) (up, down []string) {
+	var createTables, addColumns, dropColumns, dropTables []string
+	var undoCreateTables, undoAddColumns, undoDropColumns, undoDropTables []string
+
+	for _, name := range sortedTableNames(to) {
+		t := to[name]
+		old, ok := from[name]
+		if !ok {
+			createTables = append(createTables, t.stmt)
+			undoCreateTables = append(undoCreateTables, fmt.Sprintf("DROP TABLE %s", t.name))
+			continue
+		}
+
+		for _, c := range t.columns {
+			if _, ok := old.column(c.name); !ok {
+				addColumns = append(addColumns, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.name, c.name, c.def))
+				undoAddColumns = append(undoAddColumns, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.name, c.name))
+			}
+		}
+
+		for _, c := range old.columns {
+			if _, ok := t.column(c.name); !ok {
+				dropColumns = append(dropColumns, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.name, c.name))
+				undoDropColumns = append(undoDropColumns, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.name, c.name, c.def))
+			}
+		}
+	}
+
+	for _, name := range sortedTableNames(from) {
+		if _, ok := to[name]; !ok {
+			t := from[name]
+			dropTables = append(dropTables, fmt.Sprintf("DROP TABLE %s", t.name))
+			undoDropTables = append(undoDropTables, t.stmt)
+		}
+	}
+
+	up = concat(createTables, addColumns, dropColumns, dropTables)
+	down = concat(undoDropTables, undoDropColumns, undoAddColumns, undoCreateTables)
+	return up, down
+}
+
+func concat(lists ...[]string) []string {
+	var result []string
+	for _, l := range lists {
+		result = append(result, l...)
+	}
+	return result
+}
+
+func sortedTableNames(tables map[string]*table) []string {
+	var names = make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var createTableRegex = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([^\s(]+)\s*\((.*)\)[^)]*$`)
+
+// parseSchema returns the tables created in the given schema, indexed by
+// their lowercased name. It is a best effort parser that only understands
+// CREATE TABLE statements, the rest of statements are ignored.
+func parseSchema(schema string) map[string]*table {
+	tables := make(map[string]*table)
+	for _, stmt := range mig.SplitStatements(schema) {
+		m := createTableRegex.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+
+		t := &table{name: m[1], stmt: stmt}
+		for _, def := range splitColumns(m[2]) {
+			if c, ok := parseColumn(def); ok {
+				t.columns = append(t.columns, c)
+			}
+		}
+
+		tables[strings.ToLower(unquoteIdent(t.name))] = t
+	}
+	return tables
+}
+
+var constraintKeywords = []string{"constraint", "primary", "unique", "foreign", "check", "key", "index", "exclude"}
+
+// parseColumn parses a column definition of a CREATE TABLE statement. It
+// returns false if the definition is a table constraint instead.
+func parseColumn(def string) (column, bool) {
+	fields := strings.Fields(def)
+	if len(fields) == 0 {
+		return column{}, false
+	}
+
+	for _, kw := range constraintKeywords {
+		if strings.EqualFold(fields[0], kw) {
+			return column{}, false
+		}
+	}
+
+	name := fields[0]
+	return column{
+		name: name,
+		def:  strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(def), name)),
+	}, true
+}
+
+func unquoteIdent(name string) string {
+	return strings.Trim(name, "\"`[]")
+}
+
+// splitColumns splits the definitions of the columns and constraints of a
+// CREATE TABLE statement, ignoring the commas inside parenthesis and quotes.
+// Statements are split with mig.SplitStatements, which already removed the
+// comments. The parts are trimmed and empty parts are discarded.
+func splitColumns(defs string) []string {
+	var (
+		parts []string
+		buf   strings.Builder
+		depth int
+		quote rune
+	)
+
+	flush := func() {
+		if part := strings.TrimSpace(buf.String()); part != "" {
+			parts = append(parts, part)
+		}
+		buf.Reset()
+	}
+
+	for _, r := range defs {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			flush()
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	flush()
+
+	return parts
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTables(t *testing.T) {
+	from := parseSchema(`
+		-- users of the app
+		CREATE TABLE users (
+			id integer PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			legacy text,
+			CONSTRAINT users_name UNIQUE (name)
+		);
+
+		CREATE TABLE old_stuff (id integer);
+		CREATE INDEX users_name_idx ON users (name);
+	`)
+
+	to := parseSchema(`
+		CREATE TABLE users (
+			id integer PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			email varchar(255) DEFAULT 'a,b',
+			CONSTRAINT users_name UNIQUE (name)
+		);
+
+		CREATE TABLE IF NOT EXISTS posts (id integer, title text);
+	`)
+
+	up, down := diffTables(from, to)
+
+	expectedUp := []string{
+		"CREATE TABLE IF NOT EXISTS posts (id integer, title text)",
+		"ALTER TABLE users ADD COLUMN email varchar(255) DEFAULT 'a,b'",
+		"ALTER TABLE users DROP COLUMN legacy",
+		"DROP TABLE old_stuff",
+	}
+
+	expectedDown := []string{
+		"CREATE TABLE old_stuff (id integer)",
+		"ALTER TABLE users ADD COLUMN legacy text",
+		"ALTER TABLE users DROP COLUMN email",
+		"DROP TABLE posts",
+	}
+
+	if !reflect.DeepEqual(up, expectedUp) {
+		t.Errorf("unexpected up:\n\t(GOT): %q\n\t(WNT): %q", up, expectedUp)
+	}
+
+	if !reflect.DeepEqual(down, expectedDown) {
+		t.Errorf("unexpected down:\n\t(GOT): %q\n\t(WNT): %q", down, expectedDown)
+	}
+}
+
+func TestDiffTables_Equal(t *testing.T) {
+	schema := parseSchema(`CREATE TABLE foo (id integer);`)
+	up, down := diffTables(schema, schema)
+	if len(up) != 0 || len(down) != 0 {
+		t.Errorf("expecting no statements, got: %q, %q", up, down)
+	}
+}
+
+func TestDiffTables_QuotedIdentifiers(t *testing.T) {
+	from := parseSchema(`CREATE TABLE "foo" ("id" integer, "name" text);`)
+	to := parseSchema("CREATE TABLE foo (id integer, `name` text);")
+	up, down := diffTables(from, to)
+	if len(up) != 0 || len(down) != 0 {
+		t.Errorf("expecting no statements, got: %q, %q", up, down)
+	}
+}
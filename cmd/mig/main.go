@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go/build"
 	"go/format"
+	"go/token"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -37,9 +39,51 @@ var commands = []cli.Command{
 				Value: "migrations",
 				Usage: "migrations folder path",
 			},
+			cli.BoolFlag{
+				Name:  "strict",
+				Usage: "fail if there are Go or SQL files in the migrations folder that are not correctly named migrations",
+			},
+			cli.StringFlag{
+				Name:  "style",
+				Value: string(mig.StyleExec),
+				Usage: "style of the migration, one of (exec, execall, sql)",
+			},
 		},
 		Action: create,
 	},
+	{
+		Name:  "validate",
+		Usage: "checks that the migration files are correctly named and there are no duplicated versions or gaps",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "folder, f",
+				Value: "migrations",
+				Usage: "migrations folder path",
+			},
+		},
+		Action: validate,
+	},
+	{
+		Name:      "diff-gen",
+		Usage:     "generates a migration that creates and drops the tables and columns that differ between two schema dumps",
+		ArgsUsage: "[name of the migration file]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "folder, f",
+				Value: "migrations",
+				Usage: "migrations folder path",
+			},
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "schema dump the database currently has",
+			},
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "schema dump the database should have after the migration",
+			},
+		},
+		Action: diffGen,
+	},
 	{
 		Name:  "scaffold",
 		Usage: "generates a command to manage migrations using mig",
@@ -58,6 +102,15 @@ var commands = []cli.Command{
 				Value: "",
 				Usage: "name of the package where your migrations are. If it is not provided, the folder `migrations` at the root of the current project will be used",
 			},
+			cli.StringFlag{
+				Name:  "sql-dir",
+				Value: "",
+				Usage: "path of a directory with SQL migrations. If given, a file embedding them will be written in it, or printed along with the command if --stdout is given, and the command will load them",
+			},
+			cli.BoolFlag{
+				Name:  "stdout",
+				Usage: "if given, the command is printed to the standard output instead of being written to `cmdfile`, so it can be pasted in an existing main file",
+			},
 		},
 		Action: scaffold,
 	},
@@ -71,27 +124,86 @@ func create(ctx *cli.Context) error {
 		logrus.Fatalf("invalid file name: %s", filename)
 	}
 
-	file, err := mig.Create(ctx.String("folder"), filename)
+	files, err := mig.CreateWithStyle(ctx.String("folder"), filename, mig.Style(ctx.String("style")), ctx.Bool("strict"))
 	if err != nil {
 		logrus.Error(err.Error())
 	} else {
-		logrus.Infof("created migration file: %s", file)
+		for _, file := range files {
+			logrus.Infof("created migration file: %s", file)
+		}
 	}
 
 	return nil
 }
 
+func validate(ctx *cli.Context) error {
+	errs := mig.ValidateDir(ctx.String("folder"))
+	for _, err := range errs {
+		logrus.Error(err.Error())
+	}
+
+	if len(errs) > 0 {
+		logrus.Fatalf("found %d problems in migrations folder", len(errs))
+	}
+
+	logrus.Info("all migration files are valid")
+	return nil
+}
+
+const diffGenNotice = `This migration was generated by mig diff-gen from two schema dumps. It only
+creates and drops tables and columns, so review it before running it.`
+
+func diffGen(ctx *cli.Context) error {
+	from, to := ctx.String("from"), ctx.String("to")
+	if from == "" || to == "" {
+		logrus.Fatal("both --from and --to schema files are required")
+	}
+
+	filename := ctx.Args().First()
+	if filename == "" {
+		filename = "schema_diff"
+	}
+
+	if !filenameRegex.MatchString(filename) {
+		logrus.Fatalf("invalid file name: %s", filename)
+	}
+
+	up, down, err := schemaDiff(from, to)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if len(up) == 0 {
+		logrus.Fatal("no tables or columns were added or dropped between the two schemas")
+	}
+
+	file, err := mig.CreateWithSQL(ctx.String("folder"), filename, diffGenNotice, up, down)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infof("created migration file: %s, review it before running it", file)
+	return nil
+}
+
 func scaffold(ctx *cli.Context) error {
 	var (
-		pkg  = ctx.String("package")
-		db   = ctx.String("database")
-		file = ctx.String("cmdfile")
+		pkg    = ctx.String("package")
+		db     = ctx.String("database")
+		file   = ctx.String("cmdfile")
+		sqlDir = ctx.String("sql-dir")
+		stdout = ctx.Bool("stdout")
 	)
 
 	if pkg == "" {
-		logrus.Warn("--package flag was not given, trying to find migrations in ./migrations")
 		var err error
-		pkg, err = defaultPkg()
+		if sqlDir != "" {
+			pkg, err = pkgForDir(sqlDir)
+		} else {
+			logrus.Warn("--package flag was not given, trying to find migrations in ./migrations")
+			pkg, err = defaultPkg()
+		}
+
 		if err != nil {
 			logrus.Fatal(err)
 		}
@@ -102,10 +214,58 @@ func scaffold(ctx *cli.Context) error {
 		logrus.Fatalf("unknown database type %s", db)
 	}
 
-	if _, err := os.Stat(file); err != nil && !os.IsNotExist(err) {
-		logrus.Fatalf("unknown error checking `cmdfile`: %s", err)
-	} else if err == nil {
-		logrus.Fatalf("provided `cmdfile` %q already exists", file)
+	if !stdout {
+		if _, err := os.Stat(file); err != nil && !os.IsNotExist(err) {
+			logrus.Fatalf("unknown error checking `cmdfile`: %s", err)
+		} else if err == nil {
+			logrus.Fatalf("provided `cmdfile` %q already exists, use --stdout to print the command instead", file)
+		}
+	}
+
+	var content []byte
+	var err error
+	if sqlDir != "" {
+		content, err = renderSQLCmdFileTpl(db, driver, pkg)
+	} else {
+		content, err = renderCmdFileTpl(db, driver, pkg)
+	}
+
+	if err != nil {
+		logrus.Fatalf("error rendering template file: %s", err)
+	}
+
+	var embedFile string
+	var embedContent []byte
+	if sqlDir != "" {
+		embedFile, embedContent, err = renderSQLEmbedFile(sqlDir)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if stdout {
+		if embedContent != nil {
+			fmt.Fprintf(ctx.App.Writer, "// %s\n\n", embedFile)
+			if _, err := ctx.App.Writer.Write(append(embedContent, '\n')); err != nil {
+				logrus.Fatalf("unable to write embed file: %s", err)
+			}
+			fmt.Fprintf(ctx.App.Writer, "// %s\n\n", file)
+		}
+
+		if _, err := ctx.App.Writer.Write(content); err != nil {
+			logrus.Fatalf("unable to write command: %s", err)
+		}
+		return nil
+	}
+
+	if embedContent != nil {
+		if _, err := os.Stat(embedFile); err == nil {
+			logrus.Fatalf("embed file %q already exists", embedFile)
+		}
+
+		if err := ioutil.WriteFile(embedFile, embedContent, 0644); err != nil {
+			logrus.Fatalf("unable to write embed file %q: %s", embedFile, err)
+		}
 	}
 
 	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
@@ -123,11 +283,6 @@ func scaffold(ctx *cli.Context) error {
 		}
 	}()
 
-	content, err := renderCmdFileTpl(db, driver, pkg)
-	if err != nil {
-		logrus.Fatalf("error rendering template file: %s", err)
-	}
-
 	_, err = f.Write(content)
 	if err != nil {
 		logrus.Fatalf("unable to write file at %q: %s", file, err)
@@ -146,35 +301,87 @@ var dbDrivers = map[string]string{
 }
 
 func defaultPkg() (pkg string, err error) {
+	return pkgForDir("migrations")
+}
+
+// pkgForDir returns the import path of the package in the given directory,
+// relative to the current directory.
+func pkgForDir(path string) (pkg string, err error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("error generating scaffold: unable to get working directory: %s", err)
 	}
 
-	for _, d := range build.Default.SrcDirs() {
-		if strings.HasPrefix(wd, d) {
-			dir := strings.TrimPrefix(filepath.ToSlash(strings.Replace(wd, d, "", -1)), "/")
-			pkg = filepath.Join(dir, "migrations")
+	return pkgForDirIn(wd, path)
+}
 
-			if fi, err := os.Stat(filepath.Join(wd, "migrations")); os.IsNotExist(err) {
-				return "", fmt.Errorf("unable to find a valid migrations directory at %s", pkg)
-			} else if err != nil {
-				return "", err
-			} else if !fi.IsDir() {
-				return "", fmt.Errorf("%s exists but is not a directory", filepath.Join(wd, "migrations"))
-			}
+// pkgForDirIn returns the import path of the package in the given directory,
+// relative to the directory wd. The import path is built using the path of
+// the module wd belongs to or, if it's not inside a module, its location
+// inside the GOPATH.
+func pkgForDirIn(wd, path string) (pkg string, err error) {
+	root, module, err := findModule(wd)
+	if err != nil {
+		return "", err
+	}
 
-			break
+	if root != "" {
+		rel, err := filepath.Rel(root, filepath.Join(wd, path))
+		if err != nil {
+			return "", fmt.Errorf("unable to find the package of %s: %s", path, err)
+		}
+		pkg = module + "/" + filepath.ToSlash(rel)
+	} else {
+		for _, d := range build.Default.SrcDirs() {
+			if strings.HasPrefix(wd, d) {
+				dir := strings.TrimPrefix(filepath.ToSlash(strings.Replace(wd, d, "", -1)), "/")
+				pkg = filepath.ToSlash(filepath.Join(dir, path))
+				break
+			}
 		}
 	}
 
 	if pkg == "" {
-		return "", fmt.Errorf("you need to provide the --package flag with the path to your migrations directory or create a `migrations` directory in the current directory")
+		return "", fmt.Errorf("you need to provide the --package flag with the path to your migrations directory or create a `%s` directory in the current directory", path)
+	}
+
+	if fi, err := os.Stat(filepath.Join(wd, path)); os.IsNotExist(err) {
+		return "", fmt.Errorf("unable to find a valid migrations directory at %s", pkg)
+	} else if err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		return "", fmt.Errorf("%s exists but is not a directory", filepath.Join(wd, path))
 	}
 
 	return pkg, nil
 }
 
+var moduleRegex = regexp.MustCompile(`(?m)^\s*module\s+"?([^\s"]+)"?`)
+
+// findModule walks up from the given directory looking for a go.mod file and
+// returns the directory containing it and the path of the module. Both are
+// empty if the directory is not inside a module.
+func findModule(dir string) (root, module string, err error) {
+	for {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			m := moduleRegex.FindSubmatch(content)
+			if m == nil {
+				return "", "", fmt.Errorf("unable to find the module path in %s", filepath.Join(dir, "go.mod"))
+			}
+			return dir, string(m[1]), nil
+		} else if !os.IsNotExist(err) {
+			return "", "", fmt.Errorf("unable to read %s: %s", filepath.Join(dir, "go.mod"), err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
 const cmdfileTpl = `package main
 
 import (
@@ -198,3 +405,63 @@ func renderCmdFileTpl(db, driver, pkg string) ([]byte, error) {
 
 	return format.Source([]byte(file))
 }
+
+const sqlEmbedTpl = `package %s
+
+import "embed"
+
+// FS contains all the SQL migrations in this directory.
+//
+//go:embed *.sql
+var FS embed.FS
+`
+
+const sqlCmdfileTpl = `package main
+
+import (
+	"log"
+	"os"
+
+	_ "%s"
+	"github.com/erizocosmico/mig"
+	"github.com/erizocosmico/mig/manager"
+	migrations "%s"
+)
+
+func main() {
+	if err := mig.LoadSQLFS(migrations.FS); err != nil {
+		log.Fatal(err)
+	}
+
+	manager.Run("%s", os.Args)
+}
+`
+
+func renderSQLCmdFileTpl(db, driver, pkg string) ([]byte, error) {
+	file := fmt.Sprintf(
+		sqlCmdfileTpl,
+		driver, pkg, db,
+	)
+
+	return format.Source([]byte(file))
+}
+
+// renderSQLEmbedFile returns the path and content of the Go file that embeds
+// all the SQL files in the given SQL migrations directory.
+func renderSQLEmbedFile(dir string) (string, []byte, error) {
+	name := filepath.Base(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = filepath.Base(abs)
+	}
+
+	if !token.IsIdentifier(name) {
+		return "", nil, fmt.Errorf("sql directory name %q is not a valid Go package name", name)
+	}
+
+	content, err := format.Source([]byte(fmt.Sprintf(sqlEmbedTpl, name)))
+	if err != nil {
+		return "", nil, fmt.Errorf("error rendering embed file template: %s", err)
+	}
+
+	return filepath.Join(dir, "embed.go"), content, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+func TestPkgForDirIn_Module(t *testing.T) {
+	root, err := ioutil.TempDir("", "mig-module")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	gomod := "// my project\nmodule example.com/myproject\n\ngo 1.21\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "migrations"), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "db", "migrations"), 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testCases := []struct {
+		wd       string
+		path     string
+		expected string
+	}{
+		{root, "migrations", "example.com/myproject/migrations"},
+		{root, "db/migrations", "example.com/myproject/db/migrations"},
+		{filepath.Join(root, "db"), "migrations", "example.com/myproject/db/migrations"},
+	}
+
+	for _, tt := range testCases {
+		pkg, err := pkgForDirIn(tt.wd, tt.path)
+		if err != nil {
+			t.Errorf("unexpected error for %s in %s: %s", tt.path, tt.wd, err)
+			continue
+		}
+
+		if pkg != tt.expected {
+			t.Errorf("unexpected package:\n\t(GOT): %s\n\t(WNT): %s", pkg, tt.expected)
+		}
+	}
+
+	if _, err := pkgForDirIn(root, "missing"); err == nil {
+		t.Errorf("expecting error for a missing directory")
+	}
+}
+
+func TestFindModule(t *testing.T) {
+	root, err := ioutil.TempDir("", "mig-module")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte(`module "example.com/quoted"`), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	modRoot, module, err := findModule(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if modRoot != root || module != "example.com/quoted" {
+		t.Errorf("unexpected module:\n\t(GOT): %s %s\n\t(WNT): %s %s", modRoot, module, root, "example.com/quoted")
+	}
+}
+
+func TestScaffold_Stdout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mig-scaffold")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the command file already exists, but it's not overwritten
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Commands = commands
+	app.Writer = &out
+
+	err = app.Run([]string{
+		"mig", "scaffold",
+		"--database", "sqlite3",
+		"--package", "example.com/myproject/migrations",
+		"--cmdfile", file,
+		"--stdout",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.Contains(out.String(), `"example.com/myproject/migrations"`) {
+		t.Errorf("expecting command with the migrations package, got: %s", out.String())
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(content) != "package main\n" {
+		t.Errorf("expecting command file not to be modified, got: %s", content)
+	}
+}
+
+func TestScaffold_StdoutSQLDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mig-scaffold")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sqlDir := filepath.Join(dir, "migrations")
+	if err := os.Mkdir(sqlDir, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Commands = commands
+	app.Writer = &out
+
+	err = app.Run([]string{
+		"mig", "scaffold",
+		"--database", "sqlite3",
+		"--package", "example.com/myproject/migrations",
+		"--cmdfile", filepath.Join(dir, "main.go"),
+		"--sql-dir", sqlDir,
+		"--stdout",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.Contains(out.String(), "//go:embed") {
+		t.Errorf("expecting embed file in output, got: %s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "mig.LoadSQLFS") {
+		t.Errorf("expecting command in output, got: %s", out.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(sqlDir, "embed.go")); !os.IsNotExist(err) {
+		t.Errorf("expecting embed file not to be written, got: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package mig
+
+// VersionComparator decides the order in which migrations are applied, for
+// versions that encode something other than a plain sequence, e.g. a
+// major.minor scheme packed in an int64. Versions are still int64 everywhere
+// in the API, only their ordering changes.
+type VersionComparator interface {
+	// Compare returns a negative number if version a goes before version b,
+	// a positive number if it goes after and 0 if they are the same.
+	Compare(a, b int64) int
+}
+
+// NumericComparator orders versions by their numeric value. It's the default
+// VersionComparator.
+type NumericComparator struct{}
+
+// Compare implements the VersionComparator interface.
+func (NumericComparator) Compare(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+var versionComparator VersionComparator = NumericComparator{}
+
+// SetVersionComparator sets the comparator used to order versions when
+// migrations are run. A nil comparator restores the default, which orders
+// them numerically. The version 0, the one of a database without migrations,
+// always goes before any other regardless of the comparator.
+//
+// ValidateRegistry and ValidateDir still look for gaps between versions
+// numerically, so non-linear schemes will usually need SetAllowGaps as well.
+func SetVersionComparator(c VersionComparator) {
+	if c == nil {
+		c = NumericComparator{}
+	}
+	versionComparator = c
+}
+
+// CompareVersions compares two versions with the comparator set with
+// SetVersionComparator, for tools that need to order versions the same way
+// migrations are run. It returns a negative number if version a goes before
+// version b, a positive number if it goes after and 0 if they are the same.
+func CompareVersions(a, b int64) int {
+	return compareVersions(a, b)
+}
+
+// compareVersions compares two versions with the comparator set with
+// SetVersionComparator.
+func compareVersions(a, b int64) int {
+	switch {
+	case a == b:
+		return 0
+	case a == 0:
+		return -1
+	case b == 0:
+		return 1
+	default:
+		return versionComparator.Compare(a, b)
+	}
+}
+
+// previousVersion returns the version of the registered migration that goes
+// right before the given one, or 0 if there is none.
+func previousVersion(version int64) int64 {
+	var prev int64
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, version) >= 0 {
+			break
+		}
+		prev = m.version
+	}
+	return prev
+}
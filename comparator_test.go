@@ -0,0 +1,147 @@
+package mig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// reverseComparator runs migrations from the highest version to the lowest.
+type reverseComparator struct{}
+
+func (reverseComparator) Compare(a, b int64) int {
+	return NumericComparator{}.Compare(b, a)
+}
+
+func TestSetVersionComparator(t *testing.T) {
+	defer reset()
+	defer SetVersionComparator(nil)
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	SetVersionComparator(reverseComparator{})
+
+	if v := LatestVersion(); v != 1 {
+		t.Errorf("unexpected latest version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+
+	_, newVersion, err := Up(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if newVersion != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 1)
+	}
+	assertMigration(t, []int64{3, 2, 1}, migrationUp, db)
+
+	_, newVersion, err = Down(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if newVersion != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 2)
+	}
+
+	if _, _, err := ToVersion(db, true, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2, 3}, migrationDown, db)
+}
+
+func TestNumericComparator(t *testing.T) {
+	c := NumericComparator{}
+	if c.Compare(1, 2) >= 0 || c.Compare(2, 1) <= 0 || c.Compare(2, 2) != 0 {
+		t.Errorf("unexpected numeric order")
+	}
+
+	SetVersionComparator(reverseComparator{})
+	defer SetVersionComparator(nil)
+
+	// 0 always goes first
+	if compareVersions(0, 1) >= 0 || compareVersions(1, 0) <= 0 {
+		t.Errorf("expecting version 0 to go before any other")
+	}
+}
+
+func TestSetVersionComparator_StatusPlanResume(t *testing.T) {
+	defer reset()
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	SetVersionComparator(reverseComparator{})
+
+	if _, _, err := ToVersion(db, true, 3); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	applied, pending, err := Counts(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if applied != 1 || pending != 2 {
+		t.Errorf("unexpected counts:\n\t(GOT): %d applied, %d pending\n\t(WNT): 1 applied, 2 pending", applied, pending)
+	}
+
+	plan, err := PlanBetween(3, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []PlannedMigration{{2, "test", "up"}, {1, "test", "up"}}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("unexpected plan:\n\t(GOT): %v\n\t(WNT): %v", plan, expected)
+	}
+
+	plan, err = PlanBetween(1, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected = []PlannedMigration{{1, "test", "down"}, {2, "test", "down"}}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("unexpected plan:\n\t(GOT): %v\n\t(WNT): %v", plan, expected)
+	}
+
+	if notes := ReleaseNotes(3, 1); notes != "- 2: test\n- 1: test\n" {
+		t.Errorf("unexpected release notes: %q", notes)
+	}
+
+	// 2 is the next pending migration, so once it fails it's marked as
+	// applied and only 1 is run
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("failed"))
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if _, _, err := Resume(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{3, 2, 1}, migrationUp, db)
+
+	applied, pending, err = Counts(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if applied != 3 || pending != 0 {
+		t.Errorf("unexpected counts:\n\t(GOT): %d applied, %d pending\n\t(WNT): 3 applied, 0 pending", applied, pending)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, r := range rows {
+		if r.Direction != directionUp {
+			t.Errorf("unexpected direction of version %d: %s", r.Version, r.Direction)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RegisterConditional adds a new migration that is only applied if the given
+// condition is true when it's run, e.g. to gate it behind a feature flag. If
+// the condition is false, the migration is skipped but its version is still
+// recorded, so the migrations after it run as usual. As with Register, it must
+// be called from a migration file.
+//
+// Keep in mind that this means the same version of the database can have a
+// different schema in different environments. Skipped migrations are recorded
+// and can be listed with SkippedMigrations. Rolling back a skipped migration
+// does not run its down, regardless of the value of the condition at that
+// moment.
+func RegisterConditional(condition func() bool, up, down MigrationFunc, opts ...Option) {
+	if condition == nil || up == nil || down == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register conditional"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version:   v,
+		up:        up,
+		down:      down,
+		file:      file,
+		condition: condition,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// SkippedMigrations returns the versions of the conditional migrations that
+// were skipped because their condition was false when they were applied.
+func SkippedMigrations(db *sql.DB) ([]int64, error) {
+	var versions []int64
+	err := withDatabase(db, func(db DB) error {
+		var err error
+		versions, err = skippedMigrations(db)
+		return err
+	})
+	return versions, err
+}
+
+func skippedMigrations(db DB) ([]int64, error) {
+	if err := setupSkipped(db); err != nil {
+		return nil, err
+	}
+
+	table, err := quoteTable(db, skippedTableName())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT version FROM %s ORDER BY version ASC",
+		table,
+	), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query skipped migrations: %s", err)
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("unable to scan skipped migration: %s", err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to query skipped migrations: %s", err)
+	}
+
+	return versions, nil
+}
+
+func hasConditional() bool {
+	for _, m := range migrations {
+		if m.condition != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// skipUp reports whether the up of the given migration must be skipped
+// because its condition is false, recording it as skipped if so.
+func skipUp(db DB, m migration) (bool, error) {
+	if m.condition == nil || m.condition() {
+		return false, nil
+	}
+
+	table, err := quoteTable(db, skippedTableName())
+	if err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (version, skipped_at) VALUES (%d, %d)",
+		table, m.version, time.Now().Unix(),
+	), execModeArgs()...)
+	if err != nil {
+		return false, fmt.Errorf("unable to record skipped migration %d: %s", m.version, err)
+	}
+
+	if m.env != "" {
+		warnings.add(fmt.Sprintf("migration was skipped because it is only for the %s environment", m.env))
+	} else {
+		warnings.add("migration was skipped because its condition is false")
+	}
+	return true, nil
+}
+
+// skipDown reports whether the down of the given migration must be skipped
+// because the migration was skipped when it was applied, removing it from the
+// skipped migrations if so.
+func skipDown(db DB, m migration) (bool, error) {
+	if m.condition == nil {
+		return false, nil
+	}
+
+	table, err := quoteTable(db, skippedTableName())
+	if err != nil {
+		return false, err
+	}
+
+	res, err := db.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE version = %d",
+		table, m.version,
+	), execModeArgs()...)
+	if err != nil {
+		return false, fmt.Errorf("unable to check if migration %d was skipped: %s", m.version, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unable to check if migration %d was skipped: %s", m.version, err)
+	}
+
+	return n > 0, nil
+}
+
+func skippedTableName() string {
+	return tableName + "_skipped"
+}
+
+const skippedTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	version bigint not null,
+	skipped_at bigint not null
+)
+`
+
+func setupSkipped(db DB) error {
+	table, err := quoteTable(db, skippedTableName())
+	if err != nil {
+		return err
+	}
+	return createTable(db, fmt.Sprintf(skippedTableSQL, table), skippedTableName())
+}
@@ -0,0 +1,81 @@
+package mig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterConditional(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	mockCaller("/0001_foo.go")
+	Register(newMigrationFunc(1, migrationUp, nil), newMigrationFunc(1, migrationDown, nil))
+
+	mockCaller("/0002_foo.go")
+	RegisterConditional(
+		func() bool { return false },
+		newMigrationFunc(2, migrationUp, nil),
+		newMigrationFunc(2, migrationDown, nil),
+	)
+
+	mockCaller("/0003_foo.go")
+	RegisterConditional(
+		func() bool { return true },
+		newMigrationFunc(3, migrationUp, nil),
+		newMigrationFunc(3, migrationDown, nil),
+	)
+
+	_, newVersion, err := Up(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if newVersion != 3 {
+		t.Errorf("unexpected new version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 3)
+	}
+
+	assertMigration(t, []int64{1, 3}, migrationUp, db)
+
+	skipped, err := SkippedMigrations(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(skipped, []int64{2}) {
+		t.Errorf("unexpected skipped migrations:\n\t(GOT): %v\n\t(WNT): %v", skipped, []int64{2})
+	}
+
+	if len(Warnings()) != 1 {
+		t.Errorf("unexpected number of warnings:\n\t(GOT): %d\n\t(WNT): %d", len(Warnings()), 1)
+	}
+
+	if _, _, err := ToVersion(db, true, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the down of the skipped migration is not run
+	assertMigration(t, []int64{3, 1}, migrationDown, db)
+
+	skipped, err = SkippedMigrations(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(skipped) != 0 {
+		t.Errorf("expecting no skipped migrations, got %v", skipped)
+	}
+}
+
+func TestRegisterConditional_NilCondition(t *testing.T) {
+	defer reset()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expecting panic")
+		}
+	}()
+
+	mockCaller("/0001_foo.go")
+	RegisterConditional(nil, emptyMigrationFunc, emptyMigrationFunc)
+}
@@ -0,0 +1,124 @@
+package mig
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+var databaseName string
+
+// SetDatabase sets the database, or the schema for PostgreSQL, to use before
+// running migrations in servers hosting more than one. The statement to switch
+// to it is issued once before every batch of migrations, on the same
+// connection or transaction the batch is run with. An empty name, which is the
+// default, uses the database of the connection. SQLite is not supported.
+func SetDatabase(name string) error {
+	if name != "" && !isIdentifier(name) {
+		return fmt.Errorf("invalid database name %q", name)
+	}
+
+	databaseName = name
+	return nil
+}
+
+// useDatabaseQuery returns the statement to switch to the given database for
+// the given dialect.
+func useDatabaseQuery(d Dialect, name string) (string, error) {
+	quoted, err := quoteIdent(d, name)
+	if err != nil {
+		return "", err
+	}
+
+	switch d {
+	case MySQL, MSSQL:
+		return fmt.Sprintf("USE %s", quoted), nil
+	case Postgres:
+		return fmt.Sprintf("SET search_path TO %s", quoted), nil
+	default:
+		return "", fmt.Errorf("switching databases is not supported for dialect %q", d)
+	}
+}
+
+// useDatabase switches to the database set with SetDatabase, if any.
+func useDatabase(db DB, d Dialect) error {
+	if databaseName == "" {
+		return nil
+	}
+
+	query, err := useDatabaseQuery(d, databaseName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(query, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to use database %s: %s", databaseName, err)
+	}
+	return nil
+}
+
+// withDatabase runs fn using the database set with SetDatabase. Because the
+// statement to switch databases only affects the connection it is run on, fn
+// is given a single connection of the pool in that case.
+func withDatabase(db *sql.DB, fn func(DB) error) error {
+	if databaseName == "" {
+		return fn(db)
+	}
+
+	return withConn(db, func(c connDB) error {
+		if err := useDatabase(c, c.dialect); err != nil {
+			return err
+		}
+
+		return fn(c)
+	})
+}
+
+// runDatabaseTx runs fn inside a transaction using the database set with
+// SetDatabase.
+func runDatabaseTx(db *sql.DB, fn func(DB) error) error {
+	return runTx(querierOf(db), func(tx DB) error {
+		if err := useDatabase(tx, dialectOf(db)); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// withConn runs fn with a single connection of the pool, for statements that
+// only affect the connection they are run on.
+func withConn(db *sql.DB, fn func(connDB) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to get a database connection: %s", err)
+	}
+	defer conn.Close()
+
+	return fn(connDB{conn, db, dialectOf(db)})
+}
+
+// connDB is a single connection of a pool that satisfies DB.
+type connDB struct {
+	conn *sql.Conn
+	// db is the pool the connection belongs to.
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (c connDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (c connDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (c connDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// Begin starts a transaction on the connection, so it keeps using the
+// database selected in it.
+func (c connDB) Begin() (Tx, error) {
+	return c.conn.BeginTx(context.Background(), nil)
+}
@@ -0,0 +1,102 @@
+package mig
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestSetDatabase(t *testing.T) {
+	defer SetDatabase("")
+
+	for _, name := range []string{"foo bar", "foo;", "foo.bar"} {
+		if err := SetDatabase(name); err == nil {
+			t.Errorf("expecting error with database name %q", name)
+		}
+	}
+
+	if err := SetDatabase("foo"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if databaseName != "foo" {
+		t.Errorf("unexpected database name:\n\t(GOT): %s\n\t(WNT): %s", databaseName, "foo")
+	}
+}
+
+func TestUseDatabaseQuery(t *testing.T) {
+	testCases := []struct {
+		dialect  Dialect
+		expected string
+		ok       bool
+	}{
+		{MySQL, "USE `foo`", true},
+		{MSSQL, `USE "foo"`, true},
+		{Postgres, `SET search_path TO "foo"`, true},
+		{SQLite, "", false},
+	}
+
+	for _, tt := range testCases {
+		query, err := useDatabaseQuery(tt.dialect, "foo")
+		if err != nil && tt.ok {
+			t.Errorf("unexpected error: %s", err)
+		} else if err == nil && !tt.ok {
+			t.Errorf("expecting error for dialect %s", tt.dialect)
+		} else if query != tt.expected {
+			t.Errorf("unexpected query:\n\t(GOT): %s\n\t(WNT): %s", query, tt.expected)
+		}
+	}
+}
+
+func TestSetDatabase_Unsupported(t *testing.T) {
+	defer reset()
+	defer SetDatabase("")
+
+	migrations = generateMigrations(1)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if err := SetDatabase("foo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Up(db, true); err == nil {
+		t.Errorf("expecting error")
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+}
+
+func TestSetDatabase_Bookkeeping(t *testing.T) {
+	defer reset()
+	defer SetDatabase("")
+
+	migrations = generateMigrations(1)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if err := SetDatabase("foo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// sqlite can't switch databases, so all of them fail if they use the
+	// database set
+	detect := func(*sql.DB) (int64, error) { return 1, nil }
+	for name, fn := range map[string]func() error{
+		"UpFrom":        func() error { _, _, err := UpFrom(db, true, 0, true); return err },
+		"Repair":        func() error { return Repair(db, detect) },
+		"Compact":       func() error { return Compact(db, 1) },
+		"ImportHistory": func() error { return ImportHistory(db, nil) },
+		"RunDeferred":   func() error { return RunDeferred(db) },
+		"SkippedMigrations": func() error {
+			_, err := SkippedMigrations(db)
+			return err
+		},
+	} {
+		if err := fn(); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("%s: expecting unsupported database error, got: %v", name, err)
+		}
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+}
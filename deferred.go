@@ -0,0 +1,169 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// deferredMigrations are the migrations registered with RegisterDeferred.
+var deferredMigrations []migration
+
+// RegisterDeferred adds a new deferred migration, that is, a migration that is
+// not run by Up but queued to be run later with RunDeferred. This is meant for
+// slow data backfills that should not block a deploy. As with Register, its
+// version is taken from the name of the file calling this function, and it is
+// queued once the database is migrated up to that version, so it can be
+// registered in the same file as the schema change it depends on.
+// Deferred migrations can't be rolled back.
+func RegisterDeferred(up MigrationFunc) {
+	if up == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register deferred"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	if v <= 0 {
+		panic(fmt.Errorf("version %d in file %q is not valid, it must be bigger than 0", v, file))
+	}
+
+	for _, m := range deferredMigrations {
+		if m.version == v {
+			panic(fmt.Errorf("deferred migration with number %d has already been registered in file %s", v, m.file))
+		}
+	}
+
+	deferredMigrations = append(deferredMigrations, migration{
+		version: v,
+		up:      up,
+		file:    file,
+	})
+}
+
+// RunDeferred runs all the deferred migrations that have been queued by Up
+// and were not completed yet, in order. Each one of them is run outside of a
+// transaction and marked as completed as soon as it finishes, so they should
+// be written to be safe to run again in case they fail midway.
+func RunDeferred(db *sql.DB) error {
+	return withDatabase(db, runDeferred)
+}
+
+func runDeferred(db DB) error {
+	if err := setupDeferred(db); err != nil {
+		return err
+	}
+
+	table, err := quoteTable(db, deferredTableName())
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT version FROM %s WHERE completed_at = 0 ORDER BY version ASC",
+		table,
+	), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to query pending deferred migrations: %s", err)
+	}
+
+	var pending []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return fmt.Errorf("unable to scan pending deferred migration: %s", err)
+		}
+		pending = append(pending, v)
+	}
+
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("unable to query pending deferred migrations: %s", err)
+	}
+
+	for _, v := range pending {
+		m, ok := findDeferred(v)
+		if !ok {
+			return fmt.Errorf("deferred migration %d is pending but it has not been registered", v)
+		}
+
+		if err := m.up(db); err != nil {
+			return fmt.Errorf("error applying deferred migration %d: %s", v, err)
+		}
+
+		_, err := db.Exec(fmt.Sprintf(
+			"UPDATE %s SET completed_at = %d WHERE version = %d",
+			table, time.Now().Unix(), v,
+		), execModeArgs()...)
+		if err != nil {
+			return fmt.Errorf("unable to mark deferred migration %d as completed: %s", v, err)
+		}
+	}
+
+	return nil
+}
+
+func findDeferred(version int64) (migration, bool) {
+	for _, m := range deferredMigrations {
+		if m.version == version {
+			return m, true
+		}
+	}
+	return migration{}, false
+}
+
+// queueDeferred queues the deferred migration with the given version, if any,
+// so it's run the next time RunDeferred is called.
+func queueDeferred(db DB, version int64) error {
+	if _, ok := findDeferred(version); !ok {
+		return nil
+	}
+
+	table, err := quoteTable(db, deferredTableName())
+	if err != nil {
+		return err
+	}
+
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE version = %d", table, version)
+	if err := db.QueryRow(query, execModeArgs()...).Scan(&count); err != nil {
+		return fmt.Errorf("unable to check if deferred migration %d is queued: %s", version, err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (version, queued_at, completed_at) VALUES (%d, %d, 0)",
+		table, version, time.Now().Unix(),
+	), execModeArgs()...)
+	if err != nil {
+		return fmt.Errorf("unable to queue deferred migration %d: %s", version, err)
+	}
+
+	return nil
+}
+
+func deferredTableName() string {
+	return tableName + "_deferred"
+}
+
+const deferredTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	version bigint not null,
+	queued_at bigint not null,
+	completed_at bigint not null
+)
+`
+
+func setupDeferred(db DB) error {
+	table, err := quoteTable(db, deferredTableName())
+	if err != nil {
+		return err
+	}
+	return createTable(db, fmt.Sprintf(deferredTableSQL, table), deferredTableName())
+}
@@ -0,0 +1,90 @@
+package mig
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegisterDeferred(t *testing.T) {
+	defer reset()
+
+	mockCaller("/0001_foo.go")
+	RegisterDeferred(emptyMigrationFunc)
+
+	if len(deferredMigrations) != 1 || deferredMigrations[0].version != 1 {
+		t.Errorf("unexpected deferred migrations: %v", deferredMigrations)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expecting a panic")
+		}
+	}()
+
+	RegisterDeferred(emptyMigrationFunc)
+}
+
+func TestRunDeferred(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	deferredMigrations = []migration{
+		{version: 2, up: newMigrationFunc(20, migrationUp, nil), file: "2_test.go"},
+		{version: 3, up: newMigrationFunc(30, migrationUp, nil), file: "3_test.go"},
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := ToVersion(db, true, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// deferred migrations are not run by up
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	if err := RunDeferred(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2, 20}, migrationUp, db)
+
+	// completed deferred migrations are not run again
+	if err := RunDeferred(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2, 20}, migrationUp, db)
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RunDeferred(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2, 20, 3, 30}, migrationUp, db)
+}
+
+func TestRunDeferred_Error(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(1)
+	deferredMigrations = []migration{
+		{version: 1, up: newMigrationFunc(10, migrationUp, fmt.Errorf("err")), file: "1_test.go"},
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RunDeferred(db); err == nil {
+		t.Errorf("expecting an error")
+	}
+
+	// it stays pending after failing
+	deferredMigrations[0].up = newMigrationFunc(10, migrationUp, nil)
+	if err := RunDeferred(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 10, 10}, migrationUp, db)
+}
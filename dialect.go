@@ -0,0 +1,287 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Dialect is the SQL dialect spoken by a database system.
+type Dialect string
+
+const (
+	// Postgres is the dialect of PostgreSQL.
+	Postgres Dialect = "postgres"
+	// MySQL is the dialect of MySQL.
+	MySQL Dialect = "mysql"
+	// SQLite is the dialect of SQLite3.
+	SQLite Dialect = "sqlite3"
+	// MSSQL is the dialect of Microsoft SQL Server.
+	MSSQL Dialect = "mssql"
+)
+
+var (
+	dialect Dialect
+	// detectedDialect is the dialect detected the last time dialectOf was
+	// called, used for transactions, whose driver can not be known.
+	detectedDialect Dialect
+)
+
+// SetDialect sets the dialect of the database the migrations are run against.
+// If no dialect is set, mig tries to detect it from the database driver.
+func SetDialect(d Dialect) {
+	dialect = d
+}
+
+// dialectOf returns the dialect set with SetDialect or, if there is none, the
+// one detected using the driver of the given database.
+func dialectOf(db *sql.DB) Dialect {
+	if dialect != "" {
+		return dialect
+	}
+
+	t := reflect.TypeOf(db.Driver())
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	pkg := t.PkgPath()
+	switch {
+	case strings.Contains(pkg, "sqlite"):
+		detectedDialect = SQLite
+	case strings.Contains(pkg, "pq"), strings.Contains(pkg, "pgx"):
+		detectedDialect = Postgres
+	case strings.Contains(pkg, "mysql"):
+		detectedDialect = MySQL
+	case strings.Contains(pkg, "mssql"):
+		detectedDialect = MSSQL
+	default:
+		detectedDialect = ""
+	}
+
+	return detectedDialect
+}
+
+var execMode interface{}
+
+// SetQueryExecMode sets a value that is passed as the first argument of all
+// the queries run by mig to keep track of the migrations and of the
+// statements of the migrations loaded from SQL files. It is meant for drivers
+// that accept options this way, such as pgx, which prepares and caches every
+// statement by default. That breaks when a migration alters a table that is
+// queried later in the same session, so with pgx the simple protocol should
+// be used instead:
+//
+//	mig.SetQueryExecMode(pgx.QueryExecModeSimpleProtocol)
+//
+// Queries run by migrations written in Go need to do the same themselves. A
+// nil mode, which is the default, passes no extra arguments.
+func SetQueryExecMode(mode interface{}) {
+	execMode = mode
+}
+
+// execModeArgs returns the arguments that need to be passed to the queries
+// run by mig given the mode set with SetQueryExecMode.
+func execModeArgs() []interface{} {
+	if execMode == nil {
+		return nil
+	}
+	return []interface{}{execMode}
+}
+
+// dialectFor returns the dialect of the given database. Only the dialect of a
+// *sql.DB can be detected, for transactions it is the one set with SetDialect
+// or, if there is none, the last one detected.
+func dialectFor(db DB) Dialect {
+	switch db := db.(type) {
+	case *sql.DB:
+		return dialectOf(db)
+	case sqlQuerier:
+		return dialectOf(db.DB)
+	case connDB:
+		return db.dialect
+	case protectedDB:
+		return dialectFor(db.DB)
+	}
+
+	if dialect != "" {
+		return dialect
+	}
+	return detectedDialect
+}
+
+// quoteString returns the given string as a SQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateIdent returns an error if the given name, which can be qualified
+// with a schema, is not made of valid SQL identifiers.
+func validateIdent(name string) error {
+	for _, p := range strings.Split(name, ".") {
+		if !isIdentifier(p) {
+			return fmt.Errorf("invalid identifier %q", name)
+		}
+	}
+	return nil
+}
+
+// isIdentifier reports whether the given name is a valid unquoted SQL
+// identifier.
+func isIdentifier(name string) bool {
+	return identifierRegex.MatchString(name)
+}
+
+// quoteIdent validates the given identifier, which may be qualified with a
+// schema, and quotes it for the given dialect.
+func quoteIdent(d Dialect, name string) (string, error) {
+	if err := validateIdent(name); err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if d == MySQL {
+			parts[i] = "`" + p + "`"
+		} else {
+			parts[i] = `"` + p + `"`
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// quoteTable returns the given name of a table used by mig quoted for the
+// dialect of the given database.
+func quoteTable(db DB, name string) (string, error) {
+	table, err := quoteIdent(dialectFor(db), name)
+	if err != nil {
+		return "", fmt.Errorf("invalid table name: %s", err)
+	}
+	return table, nil
+}
+
+// placeholder returns the placeholder for the nth argument of a query, starting
+// at 1, for the given dialect.
+func placeholder(d Dialect, n int) string {
+	switch d {
+	case Postgres:
+		return fmt.Sprintf("$%d", n)
+	case MSSQL:
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return "?"
+	}
+}
+
+// tableExistsQuery returns a query that returns the number of tables with the
+// given name. If the name is qualified with a schema, e.g. migrations.version,
+// the table is looked up in that schema (or attached database in SQLite)
+// instead of the current one.
+func tableExistsQuery(d Dialect, table string) string {
+	schema, name := splitSchema(table)
+	switch d {
+	case SQLite:
+		master := "sqlite_master"
+		if schema != "" {
+			master = `"` + schema + `".sqlite_master`
+		}
+		return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE type = 'table' AND name = %s", master, quoteString(name))
+	case Postgres:
+		return fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = %s AND table_name = %s", schemaOrDefault(schema, "current_schema()"), quoteString(name))
+	case MySQL:
+		return fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = %s AND table_name = %s", schemaOrDefault(schema, "DATABASE()"), quoteString(name))
+	default:
+		if schema != "" {
+			return fmt.Sprintf("SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s", quoteString(schema), quoteString(name))
+		}
+		return fmt.Sprintf("SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = %s", quoteString(name))
+	}
+}
+
+// splitSchema splits the given table name in the schema it's qualified with,
+// if any, and the name of the table.
+func splitSchema(table string) (schema, name string) {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "", table
+}
+
+// schemaOrDefault returns the given schema as a string literal or the given
+// expression if there is no schema.
+func schemaOrDefault(schema, def string) string {
+	if schema == "" {
+		return def
+	}
+	return quoteString(schema)
+}
+
+// primaryKeyQuery returns a query that returns the columns of the primary key
+// of the given table in the current database.
+func primaryKeyQuery(d Dialect, table string) string {
+	query := `SELECT kcu.column_name FROM information_schema.table_constraints tc
+JOIN information_schema.key_column_usage kcu
+	ON kcu.constraint_name = tc.constraint_name
+	AND kcu.table_schema = tc.table_schema
+	AND kcu.table_name = tc.table_name
+WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_name = %s`
+
+	switch d {
+	case Postgres:
+		query += " AND tc.table_schema = current_schema()"
+	case MySQL:
+		query += " AND tc.table_schema = DATABASE()"
+	}
+	return fmt.Sprintf(query, quoteString(table))
+}
+
+// isAlreadyExists reports whether the given error is the one returned by the
+// database when a table being created already exists. Even with IF NOT EXISTS,
+// some databases return it when several connections create the same table at
+// the same time, e.g. PostgreSQL fails with an unique violation of its catalog
+// when the concurrent transaction commits first.
+func isAlreadyExists(d Dialect, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	postgres := strings.Contains(msg, "already exists") ||
+		strings.Contains(msg, "42p07") ||
+		strings.Contains(msg, "pg_type_typname_nsp_index")
+	mysql := strings.Contains(msg, "already exists") || strings.Contains(msg, "error 1050")
+	mssql := strings.Contains(msg, "there is already an object named")
+	sqlite := strings.Contains(msg, "already exists")
+
+	switch d {
+	case Postgres:
+		return postgres
+	case MySQL:
+		return mysql
+	case MSSQL:
+		return mssql
+	case SQLite:
+		return sqlite
+	default:
+		return postgres || mysql || mssql || sqlite
+	}
+}
+
+// listTablesQuery returns a query that returns the names of the tables in the
+// current database.
+func listTablesQuery(d Dialect) string {
+	switch d {
+	case SQLite:
+		return "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'"
+	case Postgres:
+		return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()"
+	case MySQL:
+		return "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()"
+	default:
+		return "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES"
+	}
+}
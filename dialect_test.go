@@ -0,0 +1,409 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDialectOf(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	if d := dialectOf(db); d != SQLite {
+		t.Errorf("unexpected dialect:\n\t(GOT): %s\n\t(WNT): %s", d, SQLite)
+	}
+
+	SetDialect(Postgres)
+	defer SetDialect("")
+	if d := dialectOf(db); d != Postgres {
+		t.Errorf("unexpected dialect:\n\t(GOT): %s\n\t(WNT): %s", d, Postgres)
+	}
+}
+
+func TestIsInitialized(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ok {
+		t.Errorf("expecting database not to be initialized")
+	}
+
+	if _, err := CurrentVersion(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ok, err = IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !ok {
+		t.Errorf("expecting database to be initialized")
+	}
+}
+
+func TestCurrentVersionInfo(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	v, initialized, err := CurrentVersionInfo(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 0 || initialized {
+		t.Errorf("unexpected version info:\n\t(GOT): %d, %v\n\t(WNT): %d, %v", v, initialized, 0, false)
+	}
+
+	if err := SetVersion(db, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, initialized, err = CurrentVersionInfo(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 || !initialized {
+		t.Errorf("unexpected version info:\n\t(GOT): %d, %v\n\t(WNT): %d, %v", v, initialized, 2, true)
+	}
+}
+
+func TestInit(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := Init(db); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !ok {
+		t.Errorf("expecting database to be initialized")
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	testCases := []struct {
+		dialect  Dialect
+		name     string
+		expected string
+		ok       bool
+	}{
+		{Postgres, "foo", `"foo"`, true},
+		{Postgres, "public.foo", `"public"."foo"`, true},
+		{MySQL, "foo", "`foo`", true},
+		{SQLite, "foo_1", `"foo_1"`, true},
+		{Postgres, "foo bar", "", false},
+		{Postgres, "foo.", "", false},
+		{MySQL, "foo`", "", false},
+	}
+
+	for _, tt := range testCases {
+		result, err := quoteIdent(tt.dialect, tt.name)
+		if err != nil && tt.ok {
+			t.Errorf("unexpected error quoting %q: %s", tt.name, err)
+		} else if err == nil && !tt.ok {
+			t.Errorf("expecting error quoting %q", tt.name)
+		} else if result != tt.expected {
+			t.Errorf("unexpected result:\n\t(GOT): %s\n\t(WNT): %s", result, tt.expected)
+		}
+	}
+}
+
+func TestValidateTableName(t *testing.T) {
+	for _, name := range []string{"__version", "migrations.version"} {
+		if err := ValidateTableName(name); err != nil {
+			t.Errorf("unexpected error validating %q: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "foo bar", "foo;DROP TABLE users", "1foo"} {
+		if err := ValidateTableName(name); err == nil {
+			t.Errorf("expecting error validating %q", name)
+		}
+	}
+}
+
+func TestVersionTable_Quoted(t *testing.T) {
+	defer SetDialect("")
+	defer SetTableName("__version")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	// sqlite accepts the quotes used by postgres, so the queries can be run
+	SetDialect(Postgres)
+	SetTableName("MyVersions")
+
+	rec := &recordingDB{DB: db}
+	if err := setup(rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SetVersion(rec, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, err := readVersion(rec)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+
+	if len(rec.queries) != 10 {
+		t.Errorf("unexpected number of queries:\n\t(GOT): %d\n\t(WNT): %d", len(rec.queries), 10)
+	}
+
+	// both the version table and the migration log are quoted
+	for _, q := range rec.queries {
+		if !strings.Contains(q, `"MyVersions`) {
+			t.Errorf("expecting quoted table name in query: %s", q)
+		}
+	}
+}
+
+func TestDerivedTables_Quoted(t *testing.T) {
+	defer SetDialect("")
+	defer SetTableName("__version")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	SetDialect(Postgres)
+	SetTableName("MyVersions")
+
+	rec := &recordingDB{DB: db}
+	if err := setupChecksums(rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := readChecksums(rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := skippedMigrations(rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := runDeferred(rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(rec.queries) != 6 {
+		t.Errorf("unexpected number of queries:\n\t(GOT): %d\n\t(WNT): %d", len(rec.queries), 6)
+	}
+
+	for _, q := range rec.queries {
+		if !strings.Contains(q, `"MyVersions_`) {
+			t.Errorf("expecting quoted table name in query: %s", q)
+		}
+	}
+}
+
+func TestTableExistsQuery_Qualified(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = ExecAll(db,
+		`ATTACH DATABASE ':memory:' AS migrations`,
+		`CREATE TABLE migrations.version (version integer)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for table, expected := range map[string]int{
+		"migrations.version": 1,
+		"version":            0,
+		"migrations.foo":     0,
+	} {
+		var count int
+		if err := db.QueryRow(tableExistsQuery(SQLite, table)).Scan(&count); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if count != expected {
+			t.Errorf("unexpected count for %s:\n\t(GOT): %d\n\t(WNT): %d", table, count, expected)
+		}
+	}
+
+	for _, d := range []Dialect{Postgres, MySQL, MSSQL} {
+		query := tableExistsQuery(d, "migrations.version")
+		if !strings.Contains(query, "= 'migrations'") || !strings.Contains(query, "= 'version'") {
+			t.Errorf("unexpected query for %s: %s", d, query)
+		}
+	}
+}
+
+// recordingDB is a DB that records all the queries run with it.
+type recordingDB struct {
+	DB
+	queries []string
+}
+
+func (r *recordingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	r.queries = append(r.queries, query)
+	return r.DB.Exec(query, args...)
+}
+
+func (r *recordingDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	r.queries = append(r.queries, query)
+	return r.DB.Query(query, args...)
+}
+
+func (r *recordingDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	r.queries = append(r.queries, query)
+	return r.DB.QueryRow(query, args...)
+}
+
+func TestSetQueryExecMode(t *testing.T) {
+	defer SetQueryExecMode(nil)
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	type simpleProtocol struct{}
+	SetQueryExecMode(simpleProtocol{})
+
+	mdb := &modeDB{DB: db, mode: simpleProtocol{}}
+	if err := setup(mdb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SetVersion(mdb, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := readVersion(mdb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if mdb.calls != 10 {
+		t.Errorf("unexpected number of queries:\n\t(GOT): %d\n\t(WNT): %d", mdb.calls, 10)
+	}
+
+	SetQueryExecMode(nil)
+	if args := execModeArgs(); args != nil {
+		t.Errorf("expecting no args, got: %v", args)
+	}
+}
+
+// modeDB is a DB that checks that the first argument of all queries is the
+// given mode and removes it before running them.
+type modeDB struct {
+	DB
+	mode  interface{}
+	calls int
+}
+
+func (m *modeDB) strip(query string, args []interface{}) []interface{} {
+	m.calls++
+	if len(args) == 0 || args[0] != m.mode {
+		panic(fmt.Errorf("query run without mode: %s", query))
+	}
+	return args[1:]
+}
+
+func (m *modeDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return m.DB.Exec(query, m.strip(query, args)...)
+}
+
+func (m *modeDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return m.DB.Query(query, m.strip(query, args)...)
+}
+
+func (m *modeDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return m.DB.QueryRow(query, m.strip(query, args)...)
+}
+
+func TestSetup_ConcurrentCreation(t *testing.T) {
+	defer SetDialect("")
+
+	tests := []struct {
+		dialect Dialect
+		err     error
+		ok      bool
+	}{
+		{Postgres, errors.New(`pq: relation "__version" already exists`), true},
+		{Postgres, errors.New(`pq: duplicate key value violates unique constraint "pg_type_typname_nsp_index"`), true},
+		{MySQL, errors.New(`Error 1050 (42S01): Table '__version' already exists`), true},
+		{MSSQL, errors.New(`mssql: There is already an object named '__version' in the database.`), true},
+		{Postgres, errors.New(`pq: permission denied for schema public`), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			db, err := sql.Open("sqlite3", ":memory:")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer db.Close()
+
+			SetDialect(tt.dialect)
+			err = setup(&racingDB{DB: db, err: tt.err})
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if !tt.ok && err == nil {
+				t.Errorf("expecting error")
+			}
+		})
+	}
+}
+
+// racingDB is a DB that returns the given error after creating any table, as
+// if another instance had created it at the same time.
+type racingDB struct {
+	DB
+	err error
+}
+
+func (r *racingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := r.DB.Exec(query, args...)
+	if err == nil && strings.HasPrefix(strings.TrimSpace(query), "CREATE TABLE") {
+		return nil, r.err
+	}
+	return res, err
+}
@@ -0,0 +1,58 @@
+package mig
+
+import "fmt"
+
+var environment string
+
+// SetEnvironment sets the environment migrations are run in, e.g. "dev" or
+// "production". Migrations registered with RegisterFor for a different
+// environment are skipped.
+func SetEnvironment(env string) {
+	environment = env
+}
+
+// RegisterFor adds a new migration that is only applied when the environment
+// set with SetEnvironment is the given one, e.g. to insert test data only in
+// development. In any other environment the migration is skipped but its
+// version is still recorded, so dev-only migrations can live in the same
+// numbered stream as the rest. As with Register, it must be called from a
+// migration file.
+//
+// Keep in mind that this means the same version of the database can have a
+// different schema in different environments, so migrations for all
+// environments must not depend on the changes of environment-specific ones.
+// Skipped migrations are recorded and can be listed with SkippedMigrations,
+// and rolling them back does not run their down.
+func RegisterFor(env string, up, down MigrationFunc, opts ...Option) {
+	if up == nil || down == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register for"))
+	}
+
+	if env == "" {
+		panic(fmt.Errorf("environment cannot be empty in register for"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version: v,
+		up:      up,
+		down:    down,
+		file:    file,
+		env:     env,
+		condition: func() bool {
+			return environment == env
+		},
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,56 @@
+package mig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterFor(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	mockCaller("/0001_foo.go")
+	Register(newMigrationFunc(1, migrationUp, nil), newMigrationFunc(1, migrationDown, nil))
+
+	mockCaller("/0002_foo.go")
+	RegisterFor("dev", newMigrationFunc(2, migrationUp, nil), newMigrationFunc(2, migrationDown, nil))
+
+	mockCaller("/0003_foo.go")
+	RegisterFor("production", newMigrationFunc(3, migrationUp, nil), newMigrationFunc(3, migrationDown, nil))
+
+	SetEnvironment("production")
+
+	_, newVersion, err := Up(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if newVersion != 3 {
+		t.Errorf("unexpected new version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 3)
+	}
+
+	assertMigration(t, []int64{1, 3}, migrationUp, db)
+
+	skipped, err := SkippedMigrations(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(skipped, []int64{2}) {
+		t.Errorf("unexpected skipped migrations:\n\t(GOT): %v\n\t(WNT): %v", skipped, []int64{2})
+	}
+
+	expected := []Warning{{2, "migration was skipped because it is only for the dev environment"}}
+	if warnings := Warnings(); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("unexpected warnings:\n\t(GOT): %v\n\t(WNT): %v", warnings, expected)
+	}
+
+	// the down of the skipped migration is not run even in its environment
+	SetEnvironment("dev")
+	if _, _, err := ToVersion(db, true, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{3, 1}, migrationDown, db)
+}
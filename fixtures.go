@@ -0,0 +1,66 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// fixture is a migration registered with RegisterFixture.
+type fixture struct {
+	name string
+	up   MigrationFunc
+	down MigrationFunc
+}
+
+// fixtures are the registered fixtures in the order they were registered.
+var fixtures []fixture
+
+// RegisterFixture adds a new fixture, that is, a migration that only exists
+// to set up and tear down test data. Fixtures are identified by their name
+// instead of a version, are run in the order they were registered and never
+// touch the version table, so they don't count towards the version of the
+// database.
+func RegisterFixture(name string, up, down MigrationFunc) {
+	if up == nil || down == nil {
+		panic(fmt.Errorf("fixtures cannot be nil in register"))
+	}
+
+	if name == "" {
+		panic(fmt.Errorf("fixture name cannot be empty"))
+	}
+
+	for _, f := range fixtures {
+		if f.name == name {
+			panic(fmt.Errorf("fixture %q has already been registered", name))
+		}
+	}
+
+	fixtures = append(fixtures, fixture{name, up, down})
+}
+
+// ApplyFixtures runs the up of all the registered fixtures in the order they
+// were registered. The version table is not read nor modified.
+func ApplyFixtures(db *sql.DB) error {
+	return withDatabase(db, func(db DB) error {
+		for _, f := range fixtures {
+			if err := f.up(db); err != nil {
+				return fmt.Errorf("error applying fixture up %s: %s", f.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RevertFixtures runs the down of all the registered fixtures in the reverse
+// order they were registered. The version table is not read nor modified.
+func RevertFixtures(db *sql.DB) error {
+	return withDatabase(db, func(db DB) error {
+		for i := len(fixtures) - 1; i >= 0; i-- {
+			f := fixtures[i]
+			if err := f.down(db); err != nil {
+				return fmt.Errorf("error applying fixture down %s: %s", f.name, err)
+			}
+		}
+		return nil
+	})
+}
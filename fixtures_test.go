@@ -0,0 +1,63 @@
+package mig
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterFixture("users", newMigrationFunc(1, migrationUp, nil), newMigrationFunc(1, migrationDown, nil))
+	RegisterFixture("posts", newMigrationFunc(2, migrationUp, nil), newMigrationFunc(2, migrationDown, nil))
+
+	if err := ApplyFixtures(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RevertFixtures(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+	assertMigration(t, []int64{2, 1}, migrationDown, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 0 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 0)
+	}
+}
+
+func TestFixtures_Error(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterFixture("users", newMigrationFunc(1, migrationUp, nil), emptyMigrationFunc)
+	RegisterFixture("posts", newMigrationFunc(2, migrationUp, errors.New("boom")), emptyMigrationFunc)
+	RegisterFixture("comments", newMigrationFunc(3, migrationUp, nil), emptyMigrationFunc)
+
+	if err := ApplyFixtures(db); err == nil {
+		t.Errorf("expecting error")
+	}
+
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+}
+
+func TestRegisterFixture_Duplicated(t *testing.T) {
+	defer reset()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expecting panic")
+		}
+	}()
+
+	RegisterFixture("users", emptyMigrationFunc, emptyMigrationFunc)
+	RegisterFixture("users", emptyMigrationFunc, emptyMigrationFunc)
+}
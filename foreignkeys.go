@@ -0,0 +1,89 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+var disableForeignKeys bool
+
+// SetDisableForeignKeys sets whether foreign key checks are disabled while
+// migrations are run, so tables can be created and filled in any order. They
+// are disabled before every batch of migrations and enabled again after it,
+// unless they were already disabled.
+//
+// On MySQL, it runs SET FOREIGN_KEY_CHECKS=0, inside the transaction if there
+// is one. SQLite ignores PRAGMA foreign_keys inside a transaction, so there
+// the checks are deferred until the transaction is committed with PRAGMA
+// defer_foreign_keys instead, and the data must be consistent by then; only
+// migrations run without a transaction have them disabled with PRAGMA
+// foreign_keys=OFF. Other dialects have no equivalent statement, so this is a
+// no-op for them.
+func SetDisableForeignKeys(disable bool) {
+	disableForeignKeys = disable
+}
+
+// withoutForeignKeys runs fn with the foreign key checks disabled if they must
+// be, as set with SetDisableForeignKeys. Since the statements to disable them
+// only affect the connection they are run on, fn is given a single connection
+// of the pool in that case.
+func withoutForeignKeys(db DB, tx bool, fn func(DB) error) error {
+	if !disableForeignKeys {
+		return fn(db)
+	}
+
+	if pool, ok := db.(*sql.DB); ok {
+		return withConn(pool, func(c connDB) error {
+			return withoutForeignKeys(c, tx, fn)
+		})
+	}
+
+	d := dialectFor(db)
+	check, disable, enable := foreignKeysQueries(d, tx)
+	if check == "" {
+		return fn(db)
+	}
+
+	var enabled int
+	if err := db.QueryRow(check, execModeArgs()...).Scan(&enabled); err != nil {
+		return fmt.Errorf("unable to check whether foreign keys are enabled: %s", err)
+	}
+
+	if enabled == 0 {
+		return fn(db)
+	}
+
+	if _, err := db.Exec(disable, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to disable foreign keys: %s", err)
+	}
+
+	err := fn(db)
+	if enable != "" {
+		// they must be enabled again even if fn failed, since the connection
+		// is reused afterwards
+		if _, enErr := db.Exec(enable, execModeArgs()...); enErr != nil && err == nil {
+			err = fmt.Errorf("unable to enable foreign keys: %s", enErr)
+		}
+	}
+
+	return err
+}
+
+// foreignKeysQueries returns the queries to check whether foreign keys are
+// enabled and to disable and enable them with the given dialect, or empty
+// queries if it has no way to do so. An empty enable query means they are
+// enabled again automatically.
+func foreignKeysQueries(d Dialect, tx bool) (check, disable, enable string) {
+	switch d {
+	case MySQL:
+		return "SELECT @@FOREIGN_KEY_CHECKS", "SET FOREIGN_KEY_CHECKS=0", "SET FOREIGN_KEY_CHECKS=1"
+	case SQLite:
+		if tx {
+			// it is reset when the transaction ends
+			return "PRAGMA foreign_keys", "PRAGMA defer_foreign_keys=ON", ""
+		}
+		return "PRAGMA foreign_keys", "PRAGMA foreign_keys=OFF", "PRAGMA foreign_keys=ON"
+	default:
+		return "", "", ""
+	}
+}
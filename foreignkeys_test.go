@@ -0,0 +1,73 @@
+package mig
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSetDisableForeignKeys(t *testing.T) {
+	defer reset()
+
+	for _, mode := range []TxMode{TxNone, TxBatch} {
+		t.Run(mode.String(), func(t *testing.T) {
+			for _, disable := range []bool{false, true} {
+				reset()
+				SetDisableForeignKeys(disable)
+
+				db, err := sql.Open("sqlite3", ":memory:")
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				db.SetMaxOpenConns(1)
+
+				// the rows of posts are inserted before the ones of users
+				mockCaller("0001_posts.go")
+				Register(func(db DB) error {
+					return ExecAll(db,
+						`CREATE TABLE users (id integer primary key)`,
+						`CREATE TABLE posts (id integer primary key, user_id integer references users (id))`,
+						`INSERT INTO posts (id, user_id) VALUES (1, 1)`,
+					)
+				}, emptyMigrationFunc)
+
+				mockCaller("0002_users.go")
+				Register(func(db DB) error {
+					return ExecAll(db, `INSERT INTO users (id) VALUES (1)`)
+				}, emptyMigrationFunc)
+
+				if _, err := db.Exec(`PRAGMA foreign_keys=ON`); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				_, _, err = UpMode(db, mode)
+				if disable && err != nil {
+					t.Errorf("unexpected error: %s", err)
+				} else if !disable && err == nil {
+					t.Errorf("expecting error with foreign key checks enabled")
+				}
+
+				var enabled int
+				if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&enabled); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				if enabled != 1 {
+					t.Errorf("expecting foreign keys to be enabled again")
+				}
+
+				db.Close()
+			}
+		})
+	}
+}
+
+func TestForeignKeysQueries(t *testing.T) {
+	if check, _, _ := foreignKeysQueries(Postgres, false); check != "" {
+		t.Errorf("expecting no queries for postgres, got: %s", check)
+	}
+
+	_, disable, enable := foreignKeysQueries(MySQL, true)
+	if disable != "SET FOREIGN_KEY_CHECKS=0" || enable != "SET FOREIGN_KEY_CHECKS=1" {
+		t.Errorf("unexpected queries for mysql: %s, %s", disable, enable)
+	}
+}
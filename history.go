@@ -0,0 +1,471 @@
+package mig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is a change of version of the database recorded in the
+// migration log.
+type HistoryEntry struct {
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Direction of the change of version, either up or down. If it's empty
+	// when imported, it is inferred from the previous entry.
+	Direction string `json:"direction,omitempty"`
+	// Outcome of the change of version, either success or failed. If it's
+	// empty when imported, the change is considered successful.
+	Outcome string `json:"outcome,omitempty"`
+	// Message is the message set with SetRunMessage when the version was
+	// recorded, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// ExportHistory returns all the events in the migration log, including the
+// failed ones, from the oldest to the newest, so they can be restored later
+// on with ImportHistory. Like HistorySince, it never modifies the database.
+func ExportHistory(db *sql.DB) ([]HistoryEntry, error) {
+	rows, err := historyRows(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	for _, r := range rows {
+		entries = append(entries, HistoryEntry{
+			Version:   r.Version,
+			UpdatedAt: r.AppliedAt,
+			Direction: r.Direction,
+			Outcome:   r.Outcome,
+			Message:   r.Message,
+		})
+	}
+	return entries, nil
+}
+
+// HistorySince returns the successful changes of version in the migration log
+// that were applied after the given time, from the oldest to the newest. It
+// never modifies the database: the version table is not created if it does
+// not exist, and if it still has the old layout, its rows are read as they
+// are.
+func HistorySince(db *sql.DB, t time.Time) ([]HistoryEntry, error) {
+	if ok, err := IsInitialized(db); err != nil || !ok {
+		return nil, err
+	}
+
+	legacy, err := hasLegacyLayout(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if legacy {
+		rows, err := legacyHistory(db)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []HistoryEntry
+		for _, r := range rows {
+			if r.AppliedAt.Unix() >= t.Unix() {
+				entries = append(entries, HistoryEntry{
+					Version:   r.Version,
+					UpdatedAt: r.AppliedAt,
+					Direction: r.Direction,
+					Outcome:   r.Outcome,
+					Message:   r.Message,
+				})
+			}
+		}
+		return entries, nil
+	}
+
+	table, err := logTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT version, applied_at, direction, outcome, %s FROM %s WHERE outcome = %s AND applied_at >= %d ORDER BY applied_at ASC",
+		messageColumn, table, quoteString(outcomeSuccess), t.Unix(),
+	)
+	return queryHistory(db, query)
+}
+
+// AppliedAt returns when the migration with the given version was last
+// applied, according to the migration log, and whether it was found at all.
+// If several migrations were applied in a single transaction, only the last
+// version is recorded, so the time returned for the others is the time of the
+// whole transaction. A version that was applied and later rolled back is still
+// found.
+func AppliedAt(db *sql.DB, version int64) (time.Time, bool, error) {
+	entries, err := HistorySince(db, time.Time{})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var appliedAt time.Time
+	var found bool
+	var prev int64
+	for _, e := range entries {
+		if compareVersions(prev, version) < 0 && compareVersions(version, e.Version) <= 0 {
+			appliedAt = e.UpdatedAt
+			found = true
+		}
+		prev = e.Version
+	}
+
+	return appliedAt, found, nil
+}
+
+// HistoryRow is an event of the migration log with all the details recorded
+// about it.
+type HistoryRow struct {
+	Version   int64
+	AppliedAt time.Time
+	// Direction of the change of version, either up or down.
+	Direction string
+	// Outcome of the change of version, either success or failed.
+	Outcome string
+	// Checksum recorded for the migration with the version the database
+	// was migrated up to the last time it was applied. It is empty for the
+	// rest of events and for migrations that have no checksum, such as the
+	// ones written in Go.
+	Checksum string
+	// AppliedBy is who applied the migration. It is empty if the migration
+	// log has no applied_by column.
+	AppliedBy string
+	// Message is the message set with SetRunMessage when the version was
+	// recorded, if any.
+	Message string
+}
+
+// historyOptionalColumns are the columns of the migration log that are read
+// by HistoryDetailed only if they exist, since mig does not create them.
+var historyOptionalColumns = []string{"applied_by"}
+
+// HistoryDetailed returns all the events in the migration log, including the
+// failed ones, from the oldest to the newest, with all the details recorded
+// about them. It is meant for debugging, so the optional columns that the
+// migration log does not have are left empty instead of failing. Like
+// HistorySince, it never modifies the database.
+func HistoryDetailed(db *sql.DB) ([]HistoryRow, error) {
+	rows, err := historyRows(db)
+	if err != nil || len(rows) == 0 {
+		return rows, err
+	}
+
+	return rows, addChecksums(db, rows)
+}
+
+// historyRows returns all the events in the migration log, or the ones the
+// rows of a version table with the old layout would be moved to, without
+// modifying the database.
+func historyRows(db *sql.DB) ([]HistoryRow, error) {
+	if ok, err := IsInitialized(db); err != nil || !ok {
+		return nil, err
+	}
+
+	legacy, err := hasLegacyLayout(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if legacy {
+		return legacyHistory(db)
+	}
+	return logHistory(db)
+}
+
+// addChecksums sets the checksum recorded for the version of the successful
+// up events of the given ones, if the checksums table exists.
+func addChecksums(db DB, rows []HistoryRow) error {
+	var count int
+	if err := db.QueryRow(tableExistsQuery(dialectFor(db), checksumsTableName()), execModeArgs()...).Scan(&count); err != nil {
+		return fmt.Errorf("unable to check if table %s exists: %s", checksumsTableName(), err)
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	checksums, err := readChecksums(db)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range rows {
+		if r.Direction == directionUp && r.Outcome == outcomeSuccess {
+			rows[i].Checksum = checksums[r.Version]
+		}
+	}
+	return nil
+}
+
+// logHistory returns all the events in the migration log, which must exist.
+func logHistory(db DB) ([]HistoryRow, error) {
+	table, err := logTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []string{"version", "applied_at", "direction", "outcome", messageColumn}
+	var optional []string
+	for _, c := range historyOptionalColumns {
+		if columns[c] {
+			selected = append(selected, c)
+			optional = append(optional, c)
+		}
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY %s ASC",
+		strings.Join(selected, ", "), table, "applied_at",
+	), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query history: %s", err)
+	}
+	defer rows.Close()
+
+	var result []HistoryRow
+	for rows.Next() {
+		var version, appliedAt int64
+		var direction, outcome string
+		var message sql.NullString
+		var values = make([]sql.NullString, len(optional))
+		dest := []interface{}{&version, &appliedAt, &direction, &outcome, &message}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("unable to scan history row: %s", err)
+		}
+
+		row := HistoryRow{
+			Version:   version,
+			AppliedAt: time.Unix(appliedAt, 0),
+			Direction: direction,
+			Outcome:   outcome,
+			Message:   message.String,
+		}
+		for i, c := range optional {
+			if c == "applied_by" {
+				row.AppliedBy = values[i].String
+			}
+		}
+		result = append(result, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read history rows: %s", err)
+	}
+
+	return result, nil
+}
+
+// legacyHistory returns the rows of a version table with the old layout as
+// the events of the migration log they would be moved to, without moving
+// them.
+func legacyHistory(db DB) ([]HistoryRow, error) {
+	versions, err := readVersionRows(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []HistoryRow
+	var prev int64
+	for _, r := range versions {
+		result = append(result, HistoryRow{
+			Version:   r.version,
+			AppliedAt: time.Unix(r.updatedAt, 0),
+			Direction: direction(prev, r.version),
+			Outcome:   outcomeSuccess,
+			Message:   r.message.String,
+		})
+		prev = r.version
+	}
+	return result, nil
+}
+
+// tableColumns returns the lowercased names of the columns of the given
+// table, which must be already quoted.
+func tableColumns(db DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get columns of table %s: %s", table, err)
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get columns of table %s: %s", table, err)
+	}
+
+	var columns = make(map[string]bool, len(names))
+	for _, n := range names {
+		columns[strings.ToLower(n)] = true
+	}
+	return columns, nil
+}
+
+// ImportHistory restores the given changes of version into the migration
+// log. Changes that already exist are left untouched and migrations are never
+// run. If the last successful imported change is newer than the current
+// version of the database, its version becomes the current one.
+func ImportHistory(db *sql.DB, entries []HistoryEntry) error {
+	if err := withDatabase(db, setup); err != nil {
+		return err
+	}
+
+	table, err := versionTable(db)
+	if err != nil {
+		return err
+	}
+
+	events, err := logTable(db)
+	if err != nil {
+		return err
+	}
+
+	return runDatabaseTx(db, func(db DB) error {
+		var prev int64
+		var latest *HistoryEntry
+		for i, e := range entries {
+			dir, outcome := e.Direction, e.Outcome
+			if dir == "" {
+				dir = direction(prev, e.Version)
+			}
+
+			if outcome == "" {
+				outcome = outcomeSuccess
+			}
+
+			if outcome == outcomeSuccess {
+				prev = e.Version
+				latest = &entries[i]
+			}
+
+			var count int
+			query := fmt.Sprintf(
+				"SELECT COUNT(*) FROM %s WHERE version = %d AND applied_at = %d AND direction = %s AND outcome = %s",
+				events, e.Version, e.UpdatedAt.Unix(), quoteString(dir), quoteString(outcome),
+			)
+			if err := db.QueryRow(query, execModeArgs()...).Scan(&count); err != nil {
+				return fmt.Errorf("unable to check if version %d is already in history: %s", e.Version, err)
+			}
+
+			if count > 0 {
+				continue
+			}
+
+			if err := appendLog(db, e.Version, dir, outcome, e.UpdatedAt.Unix(), e.Message); err != nil {
+				return err
+			}
+		}
+
+		if latest == nil {
+			return nil
+		}
+
+		var last sql.NullInt64
+		query := fmt.Sprintf("SELECT MAX(%s) FROM %s", updatedAtColumn, table)
+		if err := db.QueryRow(query, execModeArgs()...).Scan(&last); err != nil {
+			return fmt.Errorf("unable to read current version: %s", err)
+		}
+
+		if last.Valid && last.Int64 >= latest.UpdatedAt.Unix() {
+			return nil
+		}
+
+		if err := setVersionRow(db, table, latest.Version, latest.UpdatedAt.Unix(), last.Valid); err != nil {
+			return fmt.Errorf("unable to set version of database to %d: %s", latest.Version, err)
+		}
+		return nil
+	})
+}
+
+func queryHistory(db DB, query string) ([]HistoryEntry, error) {
+	rows, err := db.Query(query, execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query history: %s", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var version, updatedAt int64
+		var direction, outcome string
+		var message sql.NullString
+		if err := rows.Scan(&version, &updatedAt, &direction, &outcome, &message); err != nil {
+			return nil, fmt.Errorf("unable to scan history row: %s", err)
+		}
+
+		entries = append(entries, HistoryEntry{
+			Version:   version,
+			UpdatedAt: time.Unix(updatedAt, 0),
+			Direction: direction,
+			Outcome:   outcome,
+			Message:   message.String,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read history rows: %s", err)
+	}
+
+	return entries, nil
+}
+
+var historyFile string
+
+// SetHistoryFile sets the path of a file where, after every successful run,
+// the migrations applied are appended as JSON lines with their version, their
+// direction (up or down) and the time they were applied. It is a secondary
+// audit trail for when the version table can not be trusted, not the source of
+// truth, so errors writing it are only reported using the logger. An empty
+// path, which is the default, disables it.
+func SetHistoryFile(path string) {
+	historyFile = path
+}
+
+type historyFileEntry struct {
+	Version   int64     `json:"version"`
+	Direction string    `json:"direction"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// appendHistoryFile appends the given migrations to the history file, if any.
+func appendHistoryFile(direction string, migrations []migration) {
+	if historyFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Warnf("unable to open history file %s: %s", historyFile, err)
+		return
+	}
+
+	now := time.Now()
+	enc := json.NewEncoder(f)
+	for _, m := range migrations {
+		entry := historyFileEntry{Version: m.version, Direction: direction, AppliedAt: now}
+		if err := enc.Encode(entry); err != nil {
+			logger.Warnf("unable to write version %d to history file %s: %s", m.version, historyFile, err)
+			break
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		logger.Warnf("unable to close history file %s: %s", historyFile, err)
+	}
+}
@@ -0,0 +1,326 @@
+package mig
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportImportHistory(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	entries := []HistoryEntry{
+		{Version: 1, UpdatedAt: time.Unix(1000, 0)},
+		{Version: 2, UpdatedAt: time.Unix(2000, 0)},
+		{Version: 3, UpdatedAt: time.Unix(3000, 0)},
+	}
+
+	if err := ImportHistory(db, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// importing again should not duplicate rows
+	if err := ImportHistory(db, entries[1:]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// direction and outcome are inferred when they are not given
+	expected := make([]HistoryEntry, len(entries))
+	for i, e := range entries {
+		e.Direction, e.Outcome = "up", "success"
+		expected[i] = e
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, expected)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	entries := []HistoryEntry{
+		{Version: 1, UpdatedAt: time.Unix(1000, 0)},
+		{Version: 2, UpdatedAt: time.Unix(2000, 0)},
+		{Version: 3, UpdatedAt: time.Unix(3000, 0)},
+	}
+
+	if err := ImportHistory(db, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := HistorySince(db, time.Unix(2000, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []HistoryEntry{
+		{Version: 2, UpdatedAt: time.Unix(2000, 0), Direction: "up", Outcome: "success"},
+		{Version: 3, UpdatedAt: time.Unix(3000, 0), Direction: "up", Outcome: "success"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, expected)
+	}
+}
+
+func TestExportImportHistory_AllColumns(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	entries := []HistoryEntry{
+		{Version: 1, UpdatedAt: time.Unix(1000, 0), Direction: "up", Outcome: "success", Message: "initial"},
+		{Version: 2, UpdatedAt: time.Unix(2000, 0), Direction: "up", Outcome: "failed"},
+		{Version: 2, UpdatedAt: time.Unix(3000, 0), Direction: "up", Outcome: "success", Message: "retry"},
+		{Version: 1, UpdatedAt: time.Unix(4000, 0), Direction: "down", Outcome: "success"},
+		{Version: 1, UpdatedAt: time.Unix(5000, 0), Direction: "down", Outcome: "failed"},
+	}
+
+	if err := ImportHistory(db, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exported, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(exported, entries) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", exported, entries)
+	}
+
+	// the version is the one of the last successful change
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+
+	other, cleanup2 := initTest(t, 0)
+	defer cleanup2()
+
+	if err := ImportHistory(other, exported); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := ExportHistory(other)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(result, entries) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, entries)
+	}
+}
+
+func TestAppliedAt(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, found, err := AppliedAt(db, 1); err != nil || found {
+		t.Fatalf("expecting version not to be found before initializing, got: %v %v", found, err)
+	}
+
+	// 2 and 3 are applied in the same transaction, then rolled back to 1
+	// and 2 is applied again
+	entries := []HistoryEntry{
+		{Version: 1, UpdatedAt: time.Unix(1000, 0)},
+		{Version: 3, UpdatedAt: time.Unix(2000, 0)},
+		{Version: 1, UpdatedAt: time.Unix(3000, 0)},
+		{Version: 2, UpdatedAt: time.Unix(4000, 0)},
+	}
+
+	if err := ImportHistory(db, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		version   int64
+		appliedAt time.Time
+		found     bool
+	}{
+		{1, time.Unix(1000, 0), true},
+		{2, time.Unix(4000, 0), true},
+		{3, time.Unix(2000, 0), true},
+		{4, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		appliedAt, found, err := AppliedAt(db, tt.version)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if found != tt.found || !appliedAt.Equal(tt.appliedAt) {
+			t.Errorf("unexpected result for version %d:\n\t(GOT): %v %v\n\t(WNT): %v %v", tt.version, appliedAt, found, tt.appliedAt, tt.found)
+		}
+	}
+}
+
+func TestHistoryDetailed(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	entries := []HistoryEntry{
+		{Version: 1, UpdatedAt: time.Unix(1000, 0)},
+		{Version: 2, UpdatedAt: time.Unix(2000, 0)},
+	}
+
+	if err := ImportHistory(db, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the table has none of the optional columns
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []HistoryRow{
+		{Version: 1, AppliedAt: time.Unix(1000, 0), Direction: "up", Outcome: "success"},
+		{Version: 2, AppliedAt: time.Unix(2000, 0), Direction: "up", Outcome: "success"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", rows, expected)
+	}
+
+	if _, err := db.Exec(`ALTER TABLE "__version_log" ADD COLUMN applied_by text`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := db.Exec(`UPDATE "__version_log" SET applied_by = 'jane' WHERE version = 2`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err = HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected[1].AppliedBy = "jane"
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", rows, expected)
+	}
+}
+
+func TestHistoryDetailed_NotInitialized(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(rows) != 0 {
+		t.Errorf("expecting no rows, got %v", rows)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	defer reset()
+	defer SetHistoryFile("")
+
+	tmpDir, err := ioutil.TempDir("", "mig-history")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "history.jsonl")
+	SetHistoryFile(path)
+
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Down(db, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+
+	var result []historyFileEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e historyFileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if e.AppliedAt.IsZero() {
+			t.Errorf("expecting applied_at of version %d to be set", e.Version)
+		}
+
+		e.AppliedAt = time.Time{}
+		result = append(result, e)
+	}
+
+	expected := []historyFileEntry{
+		{Version: 1, Direction: "up"},
+		{Version: 2, Direction: "up"},
+		{Version: 3, Direction: "up"},
+		{Version: 3, Direction: "down"},
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, expected)
+	}
+}
+
+func TestHistoryFile_WriteError(t *testing.T) {
+	defer reset()
+	defer SetHistoryFile("")
+	defer SetLogger(nil)
+
+	var log recordingLogger
+	SetLogger(&log)
+	SetHistoryFile(filepath.Join("does", "not", "exist", "history.jsonl"))
+
+	migrations = generateMigrations(1)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if msgs := log.messages(); len(msgs) != 1 {
+		t.Errorf("expecting a warning, got: %v", msgs)
+	}
+}
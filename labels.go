@@ -0,0 +1,32 @@
+package mig
+
+import "database/sql"
+
+var versionLabels map[int64]string
+
+// SetVersionLabels sets the human readable labels of some versions of the
+// database, e.g. the release tag each one of them shipped with, so they can
+// be communicated externally instead of the internal migration numbers.
+func SetVersionLabels(labels map[int64]string) {
+	versionLabels = make(map[int64]string, len(labels))
+	for v, label := range labels {
+		versionLabels[v] = label
+	}
+}
+
+// Label returns the label set with SetVersionLabels for the given version, or
+// an empty string if it has none.
+func Label(version int64) string {
+	return versionLabels[version]
+}
+
+// CurrentLabel returns the label set with SetVersionLabels for the current
+// version of the database, or an empty string if it has none.
+func CurrentLabel(db *sql.DB) (string, error) {
+	v, err := CurrentVersion(db)
+	if err != nil {
+		return "", err
+	}
+
+	return Label(v), nil
+}
@@ -0,0 +1,34 @@
+package mig
+
+import "testing"
+
+func TestCurrentLabel(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 2)
+	defer cleanup()
+
+	label, err := CurrentLabel(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if label != "" {
+		t.Errorf("expecting no label, got %q", label)
+	}
+
+	SetVersionLabels(map[int64]string{2: "v2.3.0", 3: "v2.4.0"})
+
+	label, err = CurrentLabel(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if label != "v2.3.0" {
+		t.Errorf("unexpected label:\n\t(GOT): %s\n\t(WNT): %s", label, "v2.3.0")
+	}
+
+	if label := Label(1); label != "" {
+		t.Errorf("expecting no label, got %q", label)
+	}
+}
@@ -0,0 +1,216 @@
+package mig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLockTimeout is returned by Lock when the lock could not be acquired
+// before the lock timeout.
+var ErrLockTimeout = errors.New("timed out waiting for the migrations lock")
+
+var lockTimeout time.Duration
+
+const (
+	minLockBackoff = 50 * time.Millisecond
+	maxLockBackoff = time.Second
+)
+
+// SetLockTimeout sets the maximum time Lock will wait to acquire the lock
+// before giving up with ErrLockTimeout. A duration of 0, which is the default,
+// means waiting forever.
+func SetLockTimeout(d time.Duration) {
+	lockTimeout = d
+}
+
+// Lock acquires the migrations lock, so only one process at a time runs
+// migrations against the database, and returns the function to release it.
+// On PostgreSQL an advisory lock is used. On the rest of databases, the lock
+// is a row in a table, so if a process dies while holding it, it will have to
+// be removed manually.
+func Lock(db *sql.DB) (unlock func() error, err error) {
+	var release func() error
+	if dialectOf(db) == Postgres {
+		release, err = lockPostgres(db)
+	} else {
+		release, err = lockTable(db)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt32(&locksHeld, 1)
+	return func() error {
+		atomic.AddInt32(&locksHeld, -1)
+		return release()
+	}, nil
+}
+
+// locksHeld is the number of times the migrations lock is held by this
+// process, so the functions that need it don't wait for the lock the caller
+// is already holding.
+var locksHeld int32
+
+// withLockTx runs fn inside a transaction while holding the migrations lock,
+// unless this process already holds it. The lock can only be acquired with a
+// *sql.DB, so it is not acquired with a custom Querier, and other databases
+// that can't start a transaction run fn directly.
+func withLockTx(db DB, fn func(DB) error) error {
+	var q Querier
+	var pool *sql.DB
+	switch db := db.(type) {
+	case *sql.DB:
+		q, pool = querierOf(db), db
+	case connDB:
+		q, pool = db, db.db
+	case Querier:
+		q = db
+	default:
+		return fn(db)
+	}
+
+	if pool != nil && atomic.LoadInt32(&locksHeld) == 0 {
+		unlock, err := Lock(pool)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := unlock(); err != nil {
+				logger.Warnf("%s", err)
+			}
+		}()
+	}
+
+	return runTx(q, fn)
+}
+
+func lockPostgres(db *sql.DB) (func() error, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a connection to acquire the lock: %s", err)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(tableName))
+	key := int64(h.Sum32())
+
+	err = pollLock(func() (bool, error) {
+		var ok bool
+		query := fmt.Sprintf("SELECT pg_try_advisory_lock(%d)", key)
+		err := conn.QueryRowContext(context.Background(), query, execModeArgs()...).Scan(&ok)
+		return ok, err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func() error {
+		defer conn.Close()
+		query := fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key)
+		if _, err := conn.ExecContext(context.Background(), query, execModeArgs()...); err != nil {
+			return fmt.Errorf("unable to release the lock: %s", err)
+		}
+		return nil
+	}, nil
+}
+
+const lockTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	id integer not null primary key,
+	locked_at bigint not null
+)
+`
+
+func lockTableName() string {
+	return tableName + "_lock"
+}
+
+func lockTable(db *sql.DB) (func() error, error) {
+	table, err := quoteTable(db, lockTableName())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createTable(db, fmt.Sprintf(lockTableSQL, table), lockTableName()); err != nil {
+		return nil, err
+	}
+
+	err = pollLock(func() (bool, error) {
+		// there can only be a row with id 1, so the insert fails while
+		// someone else is holding the lock
+		query := fmt.Sprintf(
+			"INSERT INTO %s (id, locked_at) VALUES (1, %d)",
+			table, time.Now().Unix(),
+		)
+		_, err := db.Exec(query, execModeArgs()...)
+		if err == nil {
+			return true, nil
+		}
+
+		// if there is no lock row, the insert failed for another reason
+		var count int
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = 1", table)
+		if cerr := db.QueryRow(query, execModeArgs()...).Scan(&count); cerr != nil || count == 0 {
+			return false, err
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		query := fmt.Sprintf("DELETE FROM %s WHERE id = 1", table)
+		if _, err := db.Exec(query, execModeArgs()...); err != nil {
+			return fmt.Errorf("unable to release the lock: %s", err)
+		}
+		return nil
+	}, nil
+}
+
+// pollLock calls acquire until it returns true, waiting more and more between
+// attempts, or until the lock timeout is exceeded.
+func pollLock(acquire func() (bool, error)) error {
+	var deadline time.Time
+	if lockTimeout > 0 {
+		deadline = time.Now().Add(lockTimeout)
+	}
+
+	backoff := minLockBackoff
+	for {
+		ok, err := acquire()
+		if err != nil {
+			return fmt.Errorf("unable to acquire the lock: %s", err)
+		}
+
+		if ok {
+			return nil
+		}
+
+		wait := backoff
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return ErrLockTimeout
+			}
+
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		time.Sleep(wait)
+		if backoff *= 2; backoff > maxLockBackoff {
+			backoff = maxLockBackoff
+		}
+	}
+}
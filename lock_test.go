@@ -0,0 +1,40 @@
+package mig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLock_Timeout(t *testing.T) {
+	defer SetLockTimeout(0)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	unlock, err := Lock(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	SetLockTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := Lock(db); err != ErrLockTimeout {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrLockTimeout)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("gave up too soon, after %s", elapsed)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	unlock, err = Lock(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+package mig
+
+import "time"
+
+// Logger is used to report things that happen while migrations are being run
+// but that are not errors. *logrus.Logger satisfies this interface.
+type Logger interface {
+	Warnf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Warnf(string, ...interface{}) {}
+
+var (
+	logger        Logger = nopLogger{}
+	slowThreshold time.Duration
+)
+
+// SetLogger sets the logger used to report things that happen during
+// migrations. By default, nothing is logged.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+}
+
+// SetSlowThreshold sets the duration after which a migration that is still
+// running will be reported as slow using the logger. A duration of 0, which is
+// the default, disables it.
+func SetSlowThreshold(d time.Duration) {
+	slowThreshold = d
+}
+
+// watchSlow starts watching the given migration and returns the function that
+// needs to be called once the migration has finished.
+func watchSlow(version int64) (stop func()) {
+	if slowThreshold <= 0 {
+		return func() {}
+	}
+
+	threshold := slowThreshold
+	t := time.AfterFunc(threshold, func() {
+		logger.Warnf("migration %d still running after %s", version, threshold)
+	})
+
+	return func() {
+		t.Stop()
+	}
+}
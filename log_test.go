@@ -0,0 +1,53 @@
+package mig
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlowThreshold(t *testing.T) {
+	defer reset()
+	defer SetLogger(nil)
+	defer SetSlowThreshold(0)
+
+	migrations = generateMigrations(2)
+	migrations[1].up = func(DB) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+
+	var log recordingLogger
+	SetLogger(&log)
+	SetSlowThreshold(20 * time.Millisecond)
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := "migration 2 still running after 20ms"
+	if msgs := log.messages(); len(msgs) != 1 || msgs[0] != expected {
+		t.Errorf("unexpected messages:\n\t(GOT): %v\n\t(WNT): %v", msgs, []string{expected})
+	}
+}
+
+type recordingLogger struct {
+	mut  sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) messages() []string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return append([]string(nil), l.msgs...)
+}
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erizocosmico/mig"
+)
+
+// config is the configuration of the manager that can be given in a file
+// with the --config flag. Flags given in the command line take precedence over
+// the values of the file.
+type config struct {
+	URL         string `json:"url"`
+	Driver      string `json:"driver"`
+	Table       string `json:"table"`
+	NoTx        bool   `json:"no_tx"`
+	FailIfAhead bool   `json:"fail_if_ahead"`
+	LockTimeout string `json:"lock_timeout"`
+
+	lockTimeout time.Duration
+}
+
+var supportedDrivers = []string{"postgres", "mysql", "sqlite3", "mssql"}
+
+// loadConfig reads the config file at the given path, which can be either a
+// JSON file or a YAML file with one "key: value" per line.
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %s", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		if data, err = flatYAMLToJSON(data); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config file %s must be a .json, .yaml or .yml file", path)
+	}
+
+	var cfg config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func (c *config) validate() error {
+	if c.Driver != "" {
+		var ok bool
+		for _, d := range supportedDrivers {
+			if d == c.Driver {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return fmt.Errorf("unknown driver %q, it must be one of: %s", c.Driver, strings.Join(supportedDrivers, ", "))
+		}
+	}
+
+	if c.Table != "" {
+		if err := mig.ValidateTableName(c.Table); err != nil {
+			return err
+		}
+	}
+
+	if c.LockTimeout != "" {
+		d, err := time.ParseDuration(c.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid lock_timeout %q: %s", c.LockTimeout, err)
+		}
+		c.lockTimeout = d
+	}
+
+	return nil
+}
+
+// flatYAMLToJSON converts a YAML document made only of "key: value" lines
+// into a JSON object, so it can be decoded as the JSON config.
+func flatYAMLToJSON(data []byte) ([]byte, error) {
+	values := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("line %d: expecting `key: value`", n)
+		}
+
+		key := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicated key %q", n, key)
+		}
+
+		switch {
+		case value == "true":
+			values[key] = true
+		case value == "false":
+			values[key] = false
+		case len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0]:
+			values[key] = value[1 : len(value)-1]
+		default:
+			values[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(values)
+}
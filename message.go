@@ -0,0 +1,15 @@
+package mig
+
+var runMessage string
+
+// SetRunMessage sets a message recorded along with every version set from
+// now on, explaining why the migrations were run, e.g. "hotfix for
+// INC-1234". It is stored in the migration log. An empty message, which is
+// the default, records nothing.
+func SetRunMessage(msg string) {
+	runMessage = msg
+}
+
+// messageColumn is the column of the migration log the run message is
+// stored in.
+const messageColumn = "message"
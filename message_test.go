@@ -0,0 +1,36 @@
+package mig
+
+import "testing"
+
+func TestSetRunMessage(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(2)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := UpOne(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	SetRunMessage("hotfix for INC-1234")
+	if _, _, err := UpOne(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := HistoryDetailed(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("unexpected number of rows:\n\t(GOT): %d\n\t(WNT): %d", len(rows), 2)
+	}
+
+	if rows[0].Message != "" {
+		t.Errorf("expecting no message for version 1, got %q", rows[0].Message)
+	}
+
+	if rows[1].Message != "hotfix for INC-1234" {
+		t.Errorf("unexpected message:\n\t(GOT): %s\n\t(WNT): %s", rows[1].Message, "hotfix for INC-1234")
+	}
+}
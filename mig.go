@@ -1,11 +1,15 @@
 package mig
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"go/format"
 	"io/ioutil"
-	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -15,16 +19,87 @@ import (
 )
 
 var (
-	migrations []migration
-	tableName  = "__version"
+	// ErrNoPendingMigrations is returned when there are no migrations to run
+	// in order to get the database to the desired version.
+	ErrNoPendingMigrations = errors.New("no pending migrations to run")
+	// ErrAlreadyAtBaseline is returned when trying to roll back a database
+	// that is already at version 0.
+	ErrAlreadyAtBaseline = errors.New("database is already at version 0, there is nothing to roll back")
+	// ErrDatabaseAheadOfCode is returned when the fail if ahead option is set
+	// and the version of the database is higher than the latest migration.
+	ErrDatabaseAheadOfCode = errors.New("database version is ahead of the latest registered migration")
+	// ErrIrreversible is returned when trying to roll back a migration that
+	// was registered with RegisterIrreversible.
+	ErrIrreversible = errors.New("migration is irreversible and can not be rolled back")
+)
+
+var (
+	migrations       []migration
+	tableName        = "__version"
+	versionColumn    = "version"
+	updatedAtColumn  = "updated_at"
+	preCommitChecks  []string
+	failIfAhead      bool
+	allowGaps        bool
+	skipIrreversible bool
+	onNoChange       func(version int64)
+	maxBatch         int
 )
 
 // SetTableName sets the name of the table used to store the migrations
-// information in your database.
+// information in your database. The name is always quoted, so it is case
+// sensitive in databases such as PostgreSQL.
 func SetTableName(name string) {
 	tableName = name
 }
 
+// ValidateTableName returns an error if the given name can't be used as the
+// name of the version table. It must be a valid SQL identifier, optionally
+// qualified with a schema, e.g. migrations.version. Functions using the table
+// fail with the same error if the name set with SetTableName is not valid.
+func ValidateTableName(name string) error {
+	if err := validateIdent(name); err != nil {
+		return fmt.Errorf("invalid table name: %s", err)
+	}
+	return nil
+}
+
+// SetColumnNames sets the names of the columns of the version table used to
+// store the version and the time it was set. It is meant to adopt mig on top of
+// an existing table, so it must be called before any other function.
+func SetColumnNames(version, updatedAt string) error {
+	for _, name := range []string{version, updatedAt} {
+		if !isIdentifier(name) {
+			return fmt.Errorf("invalid column name %q", name)
+		}
+	}
+
+	if version == updatedAt {
+		return fmt.Errorf("version and updated at columns must have different names, both are %q", version)
+	}
+
+	versionColumn = version
+	updatedAtColumn = updatedAt
+	return nil
+}
+
+// SetFailIfAhead sets whether CurrentVersion, and hence all the functions to
+// run migrations, should fail with ErrDatabaseAheadOfCode when the database is
+// at a version higher than the latest registered migration. That usually means
+// an older binary is being run against a newer database.
+func SetFailIfAhead(fail bool) {
+	failIfAhead = fail
+}
+
+// SetPreCommitChecks sets the queries that will be run inside the transaction
+// right before committing it, once all the migrations have been applied. Each
+// query must return a single value, and if any of them is not truthy (true, a
+// non-zero number or a string such as "t" or "true") the transaction is rolled
+// back. Checks are only run when migrations are run inside a transaction.
+func SetPreCommitChecks(checks []string) {
+	preCommitChecks = checks
+}
+
 // DB is an interface that both a database instance and a transaction satisfy.
 // It should be able to execute and perform queries.
 type DB interface {
@@ -45,34 +120,171 @@ var caller = func() string {
 // Register adds a new migration. Its order will depend on the name of the file
 // calling this function. For example, a file named 00001_initial_migration.go
 // will be executed before a migration defined in 000004_add_users_table.go.
-// Register needs to provide both an up and a down function.
-func Register(up, down MigrationFunc) {
+// Register needs to provide both an up and a down function. Options such as
+// WithStatementTimeout can be given to change how the migration is run.
+func Register(up, down MigrationFunc, opts ...Option) {
 	if up == nil || down == nil {
 		panic(fmt.Errorf("migrations cannot be nil in register"))
 	}
 
-	file := filepath.Base(caller())
+	file := baseName(caller())
 	v, err := versionFromFile(file)
 	if err != nil {
 		panic(err)
 	}
 
-	if v <= 0 {
-		panic(fmt.Errorf("version %d in file %q is not valid, it must be bigger than 0", v, file))
+	m := migration{
+		version: v,
+		up:      up,
+		down:    down,
+		file:    file,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if err := addMigration(m); err != nil {
+		panic(err)
 	}
+}
 
-	for _, m := range migrations {
-		if m.version == v {
-			panic(fmt.Errorf("migration with number %d has already been registered in file %s", v, m.file))
+// baseName returns the last element of the given path, which can use either
+// forward slashes or backslashes as separator regardless of the current OS.
+// filepath.Base is not enough because the paths reported by runtime.Caller
+// might not use the separator of the OS they are running on.
+func baseName(file string) string {
+	return path.Base(strings.Replace(filepath.ToSlash(file), "\\", "/", -1))
+}
+
+// RegisterIrreversible registers a new migration that can not be rolled back.
+// Trying to roll it back fails with ErrIrreversible. As with Register, it
+// must be called from a migration file.
+func RegisterIrreversible(up MigrationFunc, opts ...Option) {
+	if up == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version:      v,
+		up:           up,
+		file:         file,
+		irreversible: true,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// SetMaxBatch sets the maximum number of pending migrations Up applies in a
+// single call, as a safety throttle to migrate incrementally. Counts can be
+// used afterwards to know how many migrations are still pending. A value of 0,
+// which is the default, means no limit.
+func SetMaxBatch(n int) {
+	maxBatch = n
+}
+
+// maxBatchTarget returns the version Up must stop at, starting from the
+// given version, to not apply more migrations than the maximum batch size.
+func maxBatchTarget(current int64) int64 {
+	if maxBatch <= 0 {
+		return LatestVersion()
+	}
+
+	var n int
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, current) > 0 {
+			if n++; n == maxBatch {
+				return m.version
+			}
 		}
 	}
+	return LatestVersion()
+}
 
-	migrations = append(migrations, migration{
-		version: v,
-		up:      up,
-		down:    down,
-		file:    file,
-	})
+// SetAllowGaps sets whether ValidateRegistry allows gaps between the versions
+// of the registered migrations, e.g. when versions are timestamps.
+func SetAllowGaps(allow bool) {
+	allowGaps = allow
+}
+
+// SetOnNoChange sets a function that is called with the current version
+// when Up, UpOne, UpAfter or ToVersion are run but the database is already at
+// the desired version, so no migrations are run.
+func SetOnNoChange(fn func(version int64)) {
+	onNoChange = fn
+}
+
+func notifyNoChange(version int64) {
+	if onNoChange != nil {
+		onNoChange(version)
+	}
+}
+
+// SetSkipIrreversible sets whether rolling back irreversible migrations should
+// skip them instead of failing with ErrIrreversible, so the rest of the
+// migrations can still be rolled back. Skipped migrations are reported as
+// warnings, which can be retrieved with Warnings.
+func SetSkipIrreversible(skip bool) {
+	skipIrreversible = skip
+}
+
+// ValidateRegistry checks that the registered migrations are consistent with
+// the rest of the configuration: unless allowed with SetAllowGaps, there are
+// no gaps between versions, and the labels set with SetVersionLabels are for
+// versions that exist. Registering migrations already fails for duplicated
+// versions or missing functions. It returns all the problems found combined
+// in a single error, so it can be called at startup to fail fast.
+func ValidateRegistry() error {
+	var errs []error
+	var registered = make(map[int64]bool, len(migrations))
+	sorted := sortedMigrations()
+	for i, m := range sorted {
+		registered[m.version] = true
+		if i > 0 && !allowGaps && m.version != sorted[i-1].version+1 {
+			errs = append(errs, fmt.Errorf("there is a gap between versions %d and %d", sorted[i-1].version, m.version))
+		}
+	}
+
+	var labeled []int64
+	for v := range versionLabels {
+		if v != 0 && !registered[v] {
+			labeled = append(labeled, v)
+		}
+	}
+	sort.Slice(labeled, func(i, j int) bool { return labeled[i] < labeled[j] })
+
+	for _, v := range labeled {
+		errs = append(errs, fmt.Errorf("version %d has label %q but there is no migration with that version", v, versionLabels[v]))
+	}
+
+	return errors.Join(errs...)
+}
+
+// addMigration adds the given migration to the registered migrations if its
+// version is valid and it has not been registered yet.
+func addMigration(m migration) error {
+	if m.version <= 0 {
+		return fmt.Errorf("version %d in file %q is not valid, it must be bigger than 0", m.version, m.file)
+	}
+
+	for _, other := range migrations {
+		if other.version == m.version {
+			return fmt.Errorf("migration with number %d has already been registered in file %s", m.version, other.file)
+		}
+	}
+
+	migrations = append(migrations, m)
+	return nil
 }
 
 func sortedMigrations() []migration {
@@ -82,70 +294,199 @@ func sortedMigrations() []migration {
 	return m
 }
 
-// Create creates a new migration file.
+// LatestVersion returns the last version of all the registered migrations, in
+// the order set with SetVersionComparator, or 0 if there are no migrations.
+func LatestVersion() int64 {
+	var latest int64
+	for _, m := range migrations {
+		if compareVersions(m.version, latest) > 0 {
+			latest = m.version
+		}
+	}
+	return latest
+}
+
+// DependenciesOf returns the versions of the registered migrations that must
+// be applied before the migration with the given version, in the order they
+// would be run. Migrations are currently linear, so these are all the versions
+// below the given one, but callers should not rely on that.
+func DependenciesOf(version int64) []int64 {
+	var deps []int64
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, version) < 0 {
+			deps = append(deps, m.version)
+		}
+	}
+	return deps
+}
+
+// Counts returns the number of registered migrations that have already been
+// applied to the database and the number of the ones that are still pending.
+func Counts(db *sql.DB) (applied, pending int, err error) {
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, m := range migrations {
+		if compareVersions(m.version, current) <= 0 {
+			applied++
+		} else {
+			pending++
+		}
+	}
+
+	return applied, pending, nil
+}
+
+var versionAllocator = nextVersion
+
+// SetVersionAllocator sets the function used by Create to compute the version
+// of a new migration from the sorted versions of the existing ones. By default,
+// the new version is the highest existing version plus one. A nil function
+// restores the default.
+func SetVersionAllocator(fn func(existing []int64) (int64, error)) {
+	if fn == nil {
+		fn = nextVersion
+	}
+	versionAllocator = fn
+}
+
+func nextVersion(existing []int64) (int64, error) {
+	var last int64
+	if len(existing) > 0 {
+		last = existing[len(existing)-1]
+	}
+	return last + 1, nil
+}
+
+// Create creates a new migration file. Files in the migrations directory that
+// are not correctly named migrations are ignored.
 func Create(path, name string) (string, error) {
+	return create(path, name, false, []byte(migrationTpl))
+}
+
+// CreateStrict creates a new migration file like Create, but fails if there
+// are Go or SQL files in the migrations directory that are not named following
+// the migration naming conventions, as they could have been meant to be
+// migrations and end up with the same version as the new one.
+func CreateStrict(path, name string) (string, error) {
+	return create(path, name, true, []byte(migrationTpl))
+}
+
+// CreateWithSQL creates a new migration file like Create, but its up and down
+// execute the given statements instead of being placeholders. If comment is
+// not empty, it is written at the top of the file.
+func CreateWithSQL(path, name, comment string, up, down []string) (string, error) {
+	content, err := renderSQLMigration(comment, up, down)
+	if err != nil {
+		return "", err
+	}
+
+	return create(path, name, false, content)
+}
+
+func create(path, name string, strict bool, content []byte) (string, error) {
+	files, err := createFiles(path, strict, func(version int64) []migrationFile {
+		return []migrationFile{{fmt.Sprintf("%04d_%s.go", version, name), content}}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return files[0], nil
+}
+
+type migrationFile struct {
+	name    string
+	content []byte
+}
+
+// createFiles allocates a new version in the migrations directory at path and
+// writes the files returned by the given function for that version. It
+// returns the names of the written files.
+func createFiles(path string, strict bool, files func(version int64) []migrationFile) ([]string, error) {
 	if path == "" {
 		path = "migrations"
 	}
 
 	dir, err := filepath.Abs(path)
 	if err != nil {
-		return "", fmt.Errorf("unable to get absolute path of migrations dir: %s", path)
+		return nil, fmt.Errorf("unable to get absolute path of migrations dir: %s", path)
 	}
 
 	if fi, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.Mkdir(dir, 0755); err != nil {
-			return "", fmt.Errorf("unable to create migrations directory at %s: %s", dir, err)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create migrations directory at %s: %s", dir, err)
 		}
 	} else if err != nil {
-		return "", fmt.Errorf("unexpected error checking directory: %s", err)
+		return nil, fmt.Errorf("unexpected error checking directory: %s", err)
 	} else {
 		if !fi.IsDir() {
-			return "", fmt.Errorf("migrations directory path %s already exists but it's not a directory", dir)
+			return nil, fmt.Errorf("migrations directory path %s already exists but it's not a directory", dir)
 		}
 	}
 
-	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if errs := CheckDir(dir); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	versions, err := scanDir(dir, strict)
 	if err != nil {
-		return "", fmt.Errorf("unable to get list of migrations directory files: %s", err)
+		return nil, err
 	}
 
-	var migrations []migration
-	for _, m := range matches {
-		m = filepath.Base(m)
-		if v, err := versionFromFile(m); err == nil {
-			migrations = append(migrations, migration{version: v})
-		}
+	version, err := versionAllocator(versions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to allocate a new version: %s", err)
+	}
+
+	if version <= 0 {
+		return nil, fmt.Errorf("allocated version %d is not valid, it must be bigger than 0", version)
 	}
 
-	sort.Stable(byVersion(migrations))
-	var lastVersion int64
-	if len(migrations) > 0 {
-		lastVersion = migrations[len(migrations)-1].version
+	for _, v := range versions {
+		if v == version {
+			return nil, fmt.Errorf("allocated version %d already exists", version)
+		}
 	}
 
-	filename := fmt.Sprintf("%04d_%s.go", lastVersion+1, name)
-	if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(migrationTpl), 0755); err != nil {
-		return "", fmt.Errorf("unable to create migration file: %s", err)
+	var names []string
+	for _, f := range files(version) {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.name), f.content, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create migration file: %s", err)
+		}
+		names = append(names, f.name)
 	}
 
-	return filename, nil
+	return names, nil
 }
 
 // ToVersion executes up or down migrations from the current version until the
-// target version.
-// If tx is true, all migrations will be run inside a transaction.
+// target version. A target version of 0 rolls back all the migrations.
+// If tx is true, all migrations will be run inside a transaction. Otherwise,
+// the version is recorded after every migration, so if one fails the database
+// is left at the version of the last migration that succeeded.
+//
+// Deprecated: use ToVersionMode, which also allows running every migration
+// in its own transaction. ToVersion with tx being true is the same as
+// ToVersionMode with TxBatch, and with tx being false, with TxNone.
 func ToVersion(db *sql.DB, tx bool, v int64) (oldVersion, newVersion int64, err error) {
-	oldVersion, err = CurrentVersion(db)
+	return toVersion(querierOf(db), txModeFor(tx), v)
+}
+
+func toVersion(db Querier, mode TxMode, v int64) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(db)
 	if err != nil {
 		return
 	}
 
 	if oldVersion == v {
+		notifyNoChange(v)
 		return v, v, nil
 	}
 
-	var found bool
+	var found = v == 0
 	for _, m := range migrations {
 		if m.version == v {
 			found = true
@@ -157,192 +498,1220 @@ func ToVersion(db *sql.DB, tx bool, v int64) (oldVersion, newVersion int64, err
 		return 0, 0, fmt.Errorf("unable to find a migration with version %d", v)
 	}
 
-	if v > oldVersion {
-		newVersion, err = upTo(db, tx, oldVersion, v)
+	if compareVersions(v, oldVersion) > 0 {
+		newVersion, err = upTo(db, mode, oldVersion, v)
 	} else {
-		newVersion, err = downTo(db, tx, oldVersion, v)
+		newVersion, err = downTo(db, mode, oldVersion, v)
 	}
 
 	return
 }
 
 // Up runs all the pending database migrations until it's up to date.
-// If tx is true, all migrations will be run inside a transaction.
+// If tx is true, all migrations will be run inside a transaction. Otherwise,
+// the version is recorded after every migration, so if one fails the database
+// is left at the version of the last migration that succeeded.
+// If there are no pending migrations, ErrNoPendingMigrations is returned with
+// both versions being the current one. If a maximum batch size was set with
+// SetMaxBatch, at most that number of migrations are applied.
+//
+// Deprecated: use UpMode, which also allows running every migration in its
+// own transaction. Up with tx being true is the same as UpMode with TxBatch,
+// and with tx being false, with TxNone.
 func Up(db *sql.DB, tx bool) (oldVersion, newVersion int64, err error) {
-	oldVersion, err = CurrentVersion(db)
+	return up(querierOf(db), txModeFor(tx))
+}
+
+func up(db Querier, mode TxMode) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(db)
 	if err != nil {
 		return
 	}
 
-	newVersion, err = upTo(db, tx, oldVersion, math.MaxInt64)
+	newVersion, err = upTo(db, mode, oldVersion, maxBatchTarget(oldVersion))
+	if err == ErrNoPendingMigrations {
+		newVersion = oldVersion
+		notifyNoChange(oldVersion)
+	}
 	return
 }
 
-func upTo(db *sql.DB, tx bool, oldVersion, target int64) (newVersion int64, err error) {
-	migrations := sortedMigrations()
-	var pendingMigrations []migration
-	for _, m := range migrations {
-		if m.version > oldVersion && m.version <= target {
-			pendingMigrations = append(pendingMigrations, m)
-		}
+// UpAfter runs all the pending migrations whose version is greater than the
+// given one, which is useful when versions are timestamps to only apply the
+// migrations authored after a cutoff. Pending migrations with a lower version
+// are not run.
+func UpAfter(db *sql.DB, tx bool, after int64) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(querierOf(db))
+	if err != nil {
+		return
 	}
 
-	if len(pendingMigrations) == 0 {
-		return 0, fmt.Errorf("no transactions to run")
+	from := oldVersion
+	if compareVersions(after, from) > 0 {
+		from = after
 	}
 
-	fn := func(db DB) error {
-		for _, m := range pendingMigrations {
-			newVersion = m.version
-			if err := m.up(db); err != nil {
-				return fmt.Errorf("error applying migration up %d: %s", m.version, err)
-			}
+	newVersion, err = upTo(querierOf(db), txModeFor(tx), from, LatestVersion())
+	if err == ErrNoPendingMigrations {
+		newVersion = oldVersion
+		notifyNoChange(oldVersion)
+	}
+	return
+}
+
+// UpFrom runs all the migrations above the given version, treating it as the
+// current version of the database instead of reading the version table. If
+// record is true, the resulting version is recorded as any other run,
+// otherwise the version table is left untouched, as with Reapply. The
+// returned old version is the one recorded before running them, as in Up.
+//
+// This is an advanced and dangerous operation meant for disaster recovery,
+// when the version table can not be trusted. Migrations that were already
+// applied will run again if the given version is lower than the real one.
+func UpFrom(db *sql.DB, tx bool, from int64, record bool) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(querierOf(db))
+	if err != nil {
+		return
+	}
+
+	if !record {
+		next, ok := nextMigrationVersion(from)
+		if !ok {
+			return oldVersion, oldVersion, ErrNoPendingMigrations
 		}
 
-		return SetVersion(db, newVersion)
+		latest := LatestVersion()
+		if err = Reapply(db, tx, next, latest); err != nil {
+			return oldVersion, oldVersion, err
+		}
+		return oldVersion, latest, nil
 	}
 
-	if tx {
-		return newVersion, runTx(db, fn)
+	newVersion, err = upTo(querierOf(db), txModeFor(tx), from, LatestVersion())
+	if err == ErrNoPendingMigrations {
+		newVersion = oldVersion
 	}
-	return newVersion, fn(db)
+	return
 }
 
-// Down rolls back a single database migration.
-// If tx is true, all migrations will be run inside a transaction.
-func Down(db *sql.DB, tx bool) (oldVersion, newVersion int64, err error) {
-	oldVersion, err = CurrentVersion(db)
+// UpOne applies only the next pending migration.
+// It returns ErrNoPendingMigrations if the database is already up to date.
+func UpOne(db *sql.DB, tx bool) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(querierOf(db))
 	if err != nil {
-		return 0, 0, err
+		return
 	}
 
-	newVersion, err = downTo(db, tx, oldVersion, oldVersion-1)
-	return
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, oldVersion) > 0 {
+			newVersion, err = upTo(querierOf(db), txModeFor(tx), oldVersion, m.version)
+			return
+		}
+	}
+
+	notifyNoChange(oldVersion)
+	return oldVersion, oldVersion, ErrNoPendingMigrations
 }
 
-func downTo(db *sql.DB, tx bool, oldVersion, target int64) (newVersion int64, err error) {
-	migrations := sortedMigrations()
-	var pendingMigrations []migration
-	for i := len(migrations) - 1; i >= 0; i-- {
-		version := migrations[i].version
-		if version <= oldVersion && version > target {
-			pendingMigrations = append(pendingMigrations, migrations[i])
-		}
+// Resume is the recovery path when a migration run without a transaction
+// failed midway. Once the changes of the failed migration are completed
+// manually, Resume records it as applied without running it and then runs
+// the rest of pending migrations, without running again the ones that
+// succeeded. The failed migration is the one whose failure is the last event
+// of the migration log, and it must be the next pending migration. If its
+// version was already recorded manually with SetVersion, only the rest of
+// pending migrations are run.
+// If there are no more pending migrations after it, no error is returned.
+func Resume(db *sql.DB, tx bool) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(querierOf(db))
+	if err != nil {
+		return
 	}
 
-	if len(pendingMigrations) == 0 {
-		return 0, fmt.Errorf("no transactions to run")
+	var failed int64
+	err = withDatabase(db, func(db DB) error {
+		var err error
+		failed, err = failedMigration(db)
+		return err
+	})
+	if err != nil {
+		return oldVersion, oldVersion, err
 	}
 
-	fn := func(db DB) error {
-		for _, m := range pendingMigrations {
-			newVersion = m.version
-			if err := m.down(db); err != nil {
-				return fmt.Errorf("error applying migration down %d: %s", newVersion, err)
-			}
+	if failed != oldVersion {
+		next, ok := nextMigrationVersion(oldVersion)
+		if !ok {
+			return oldVersion, oldVersion, ErrNoPendingMigrations
+		}
+
+		if next != failed {
+			return oldVersion, oldVersion, fmt.Errorf(
+				"can not resume from migration %d, the next pending migration is %d",
+				failed, next,
+			)
 		}
-		newVersion--
 
-		return SetVersion(db, newVersion)
+		err = withDatabase(db, func(db DB) error {
+			return SetVersion(db, failed)
+		})
+		if err != nil {
+			return oldVersion, oldVersion, err
+		}
 	}
 
-	if tx {
-		return newVersion, runTx(db, fn)
+	newVersion, err = upTo(querierOf(db), txModeFor(tx), failed, LatestVersion())
+	if err == ErrNoPendingMigrations {
+		return oldVersion, failed, nil
 	}
-	return newVersion, fn(db)
+	return
 }
 
-func runTx(db *sql.DB, fn func(DB) error) (err error) {
-	var tx *sql.Tx
-	tx, err = db.Begin()
+// failedMigration returns the version of the migration that failed applying
+// it up, according to the migration log. Its failure must be the last event
+// of the log, or the one before its version was recorded manually.
+func failedMigration(db DB) (int64, error) {
+	if versionStore != nil {
+		return 0, fmt.Errorf("can not find the failed migration, there is no migration log with a version store")
+	}
+
+	rows, err := logHistory(db)
 	if err != nil {
-		return fmt.Errorf("unable to start transaction: %s", err)
+		return 0, err
 	}
 
-	if err := fn(tx); err != nil {
-		if err := tx.Rollback(); err != nil {
-			return fmt.Errorf("unable to rollback: %s", err)
-		}
+	failedUp := func(r HistoryRow) bool {
+		return r.Direction == directionUp && r.Outcome == outcomeFailed
+	}
 
-		return fmt.Errorf("transaction was rolled back: %s", err)
+	n := len(rows)
+	if n > 0 && failedUp(rows[n-1]) {
+		return rows[n-1].Version, nil
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("unable to commit transaction: %s", err)
+	if n > 1 && failedUp(rows[n-2]) && rows[n-1].Outcome == outcomeSuccess && rows[n-1].Version == rows[n-2].Version {
+		return rows[n-1].Version, nil
 	}
 
-	return nil
+	return 0, fmt.Errorf("there is no failed migration to resume")
 }
 
-// CurrentVersion returns the current version of the database.
-func CurrentVersion(db *sql.DB) (version int64, err error) {
-	if err = setup(db); err != nil {
-		return
+// Reapply runs the up functions of all the registered migrations with a
+// version in the range [from, to], both included, without reading nor
+// updating the version recorded in the database. If tx is true, all of them
+// are run inside a single transaction.
+//
+// This bypasses all the safety checks of the rest of operations: migrations
+// that are already applied are run again, so it must only be used with
+// migrations that are idempotent, for example to recover environments that
+// drifted from the recorded version. Use UpFrom instead to also record the
+// resulting version.
+func Reapply(db *sql.DB, tx bool, from, to int64) error {
+	if compareVersions(from, to) > 0 {
+		return fmt.Errorf("invalid range to reapply, %d is after %d", from, to)
 	}
 
-	query := fmt.Sprintf("SELECT version FROM %s ORDER BY updated_at DESC", tableName)
-	err = db.QueryRow(query).Scan(&version)
-	if err == sql.ErrNoRows {
-		return 0, nil
-	} else if err != nil {
-		return 0, fmt.Errorf("error checking current version: %s", err)
+	var ms []migration
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, from) >= 0 && compareVersions(m.version, to) <= 0 {
+			ms = append(ms, m)
+		}
 	}
 
-	return
-}
+	if len(ms) == 0 {
+		return ErrNoPendingMigrations
+	}
 
-// SetVersion sets the current version of the database to the given version.
-func SetVersion(db DB, v int64) error {
-	query := fmt.Sprintf("INSERT INTO %s (version, updated_at) VALUES (%d, %d)", tableName, v, time.Now().Unix())
-	_, err := db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("error setting version of database to %d: %s", v, err)
+	if err := checkRequireTx(ms); err != nil {
+		return err
 	}
-	return nil
-}
 
-const migrationsTableSQL = `
-CREATE TABLE IF NOT EXISTS %s (
-	version bigint not null,
-	updated_at bigint not null
-)
-`
+	if err := checkNeedsTx(ms, txModeFor(tx)); err != nil {
+		return err
+	}
 
-func setup(db *sql.DB) error {
-	_, err := db.Exec(fmt.Sprintf(migrationsTableSQL, tableName))
-	if err != nil {
-		return fmt.Errorf("unable to create table %s: %s", tableName, err)
+	for _, g := range groupByTx(ms, txModeFor(tx)) {
+		err := runBatch(querierOf(db), g.tx, func(db DB) error {
+			for _, m := range g.migrations {
+				if err := m.run(db, g.tx, m.up); err != nil {
+					return fmt.Errorf("error reapplying migration up %d: %s", m.version, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-type migration struct {
-	version int64
-	up      MigrationFunc
-	down    MigrationFunc
-	file    string
+// nextMigrationVersion returns the version of the first migration after the
+// given one.
+func nextMigrationVersion(version int64) (int64, bool) {
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, version) > 0 {
+			return m.version, true
+		}
+	}
+	return 0, false
 }
 
-type byVersion []migration
+func upTo(db Querier, mode TxMode, oldVersion, target int64) (newVersion int64, err error) {
+	migrations := sortedMigrations()
+	var pendingMigrations []migration
+	for _, m := range migrations {
+		if compareVersions(m.version, oldVersion) > 0 && compareVersions(m.version, target) <= 0 {
+			pendingMigrations = append(pendingMigrations, m)
+		}
+	}
 
-func (m byVersion) Len() int           { return len(m) }
-func (m byVersion) Less(i, j int) bool { return m[i].version < m[j].version }
-func (m byVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+	if len(pendingMigrations) == 0 {
+		return 0, ErrNoPendingMigrations
+	}
 
-func versionFromFile(file string) (int64, error) {
-	if !strings.HasSuffix(file, ".go") {
-		return 0, fmt.Errorf("migration file %s should have .go extension", file)
+	if err := checkRequireTx(pendingMigrations); err != nil {
+		return 0, err
 	}
 
-	if idx := strings.IndexRune(file, '_'); idx >= 0 {
-		v, err := strconv.ParseInt(file[:idx], 10, 64)
-		if err == nil {
-			return v, nil
-		}
+	if err := checkNeedsTx(pendingMigrations, mode); err != nil {
+		return 0, err
 	}
 
-	return 0, fmt.Errorf("migration file name must be NUMBER_NAME.go, is %s", file)
+	if err := runPreflight(db); err != nil {
+		return 0, err
+	}
+
+	if err := checkChecksums(db, oldVersion); err != nil {
+		return 0, err
+	}
+
+	ctx, end := startSpan(context.Background(), batchSpanName("up"))
+	defer func() { end(err) }()
+
+	warnings.reset()
+	steps.reset()
+	resetRowsAffected()
+	for _, g := range withCheckpoints(groupByTx(pendingMigrations, mode)) {
+		first := steps.len()
+		err = runBatch(db, g.tx, func(db DB) error {
+			for _, m := range g.migrations {
+				newVersion = m.version
+				warnings.setVersion(m.version)
+				skip, err := skipUp(db, m)
+				if err != nil {
+					return err
+				}
+
+				if skip {
+					steps.skip(m, directionUp)
+				} else {
+					_, end := startSpan(ctx, migrationSpanName(m.version, "up"))
+					stop := watchSlow(m.version)
+					start := time.Now()
+					err := m.run(db, g.tx, m.up)
+					steps.add(m, directionUp, time.Since(start), err)
+					stop()
+					end(err)
+					if err != nil {
+						return fmt.Errorf("error applying migration up %d: %s", m.version, err)
+					}
+
+					if err := recordChecksum(db, m); err != nil {
+						return err
+					}
+				}
+
+				if err := queueDeferred(db, m.version); err != nil {
+					return err
+				}
+
+				// without a transaction the version is recorded after every
+				// migration, so a failure does not lose the progress made
+				if !g.tx {
+					if err := SetVersion(db, m.version); err != nil {
+						return err
+					}
+				}
+			}
+
+			if !g.tx {
+				return nil
+			}
+			return SetVersion(db, newVersion)
+		})
+		if err != nil {
+			if g.tx {
+				steps.rollBackSince(first)
+			}
+			logFailure(db, newVersion, directionUp)
+			return newVersion, err
+		}
+
+		appendHistoryFile("up", g.migrations)
+	}
+
+	return newVersion, nil
+}
+
+// Down rolls back a single database migration.
+// If tx is true, all migrations will be run inside a transaction.
+func Down(db *sql.DB, tx bool) (oldVersion, newVersion int64, err error) {
+	return down(querierOf(db), tx)
+}
+
+func down(db Querier, tx bool) (oldVersion, newVersion int64, err error) {
+	oldVersion, err = currentVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if oldVersion <= 0 {
+		return oldVersion, oldVersion, ErrAlreadyAtBaseline
+	}
+
+	newVersion, err = downTo(db, txModeFor(tx), oldVersion, previousVersion(oldVersion))
+	return
+}
+
+func downTo(db Querier, mode TxMode, oldVersion, target int64) (newVersion int64, err error) {
+	migrations := sortedMigrations()
+	var pendingMigrations []migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		version := migrations[i].version
+		if compareVersions(version, oldVersion) <= 0 && compareVersions(version, target) > 0 {
+			pendingMigrations = append(pendingMigrations, migrations[i])
+		}
+	}
+
+	if len(pendingMigrations) == 0 {
+		return 0, ErrNoPendingMigrations
+	}
+
+	if err := checkRequireTx(pendingMigrations); err != nil {
+		return 0, err
+	}
+
+	if err := checkNeedsTx(pendingMigrations, mode); err != nil {
+		return 0, err
+	}
+
+	if err := runPreflight(db); err != nil {
+		return 0, err
+	}
+
+	// versionAfter returns the version the database is at after rolling back
+	// the first n pending migrations.
+	versionAfter := func(n int) int64 {
+		if n < len(pendingMigrations) {
+			return pendingMigrations[n].version
+		}
+		return target
+	}
+
+	ctx, end := startSpan(context.Background(), batchSpanName("down"))
+	defer func() { end(err) }()
+
+	warnings.reset()
+	steps.reset()
+	resetRowsAffected()
+	var done int
+	for _, g := range groupByTx(pendingMigrations, mode) {
+		first := steps.len()
+		err = runBatch(db, g.tx, func(db DB) error {
+			for i, m := range g.migrations {
+				newVersion = m.version
+				warnings.setVersion(m.version)
+				skip, err := skipDown(db, m)
+				if err != nil {
+					return err
+				}
+
+				switch {
+				case skip:
+					steps.skip(m, directionDown)
+				case m.down == nil:
+					if !skipIrreversible {
+						return fmt.Errorf("error applying migration down %d: %w", m.version, ErrIrreversible)
+					}
+
+					warnings.add("irreversible migration was skipped, its changes are still in the database")
+					steps.skip(m, directionDown)
+				default:
+					_, end := startSpan(ctx, migrationSpanName(m.version, "down"))
+					stop := watchSlow(m.version)
+					start := time.Now()
+					err := m.run(db, g.tx, m.down)
+					steps.add(m, directionDown, time.Since(start), err)
+					stop()
+					end(err)
+					if err != nil {
+						return fmt.Errorf("error applying migration down %d: %s", newVersion, err)
+					}
+				}
+
+				if !g.tx {
+					if err := SetVersion(db, versionAfter(done+i+1)); err != nil {
+						return err
+					}
+				}
+			}
+
+			if !g.tx {
+				return nil
+			}
+			return SetVersion(db, versionAfter(done+len(g.migrations)))
+		})
+		if err != nil {
+			if g.tx {
+				steps.rollBackSince(first)
+			}
+			logFailure(db, newVersion, directionDown)
+			return newVersion, err
+		}
+
+		appendHistoryFile("down", g.migrations)
+		done += len(g.migrations)
+	}
+
+	return target, nil
+}
+
+// runBatch runs the given batch of migrations, inside a transaction if tx is
+// true, on a connection using the database set with SetDatabase.
+func runBatch(db Querier, tx bool, fn func(DB) error) error {
+	if !tx {
+		return withQuerier(db, func(db DB) error {
+			return withoutForeignKeys(db, false, fn)
+		})
+	}
+
+	return runTx(db, func(tx DB) error {
+		if err := useDatabase(tx, dialectFor(db)); err != nil {
+			return err
+		}
+		return withoutForeignKeys(tx, true, fn)
+	})
+}
+
+func runTx(db Querier, fn func(DB) error) (err error) {
+	var tx Tx
+	tx, err = db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %s", err)
+	}
+
+	err = fn(tx)
+	if err == nil {
+		err = runPreCommitChecks(tx)
+	}
+
+	if err != nil {
+		// keep the original error, otherwise the cause of the rollback would
+		// be lost if the rollback fails as well
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("unable to rollback: %s", rbErr))
+		}
+
+		return fmt.Errorf("transaction was rolled back: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %s", err)
+	}
+
+	return nil
+}
+
+func runPreCommitChecks(db DB) error {
+	for _, check := range preCommitChecks {
+		var result interface{}
+		if err := db.QueryRow(check, execModeArgs()...).Scan(&result); err != nil {
+			return fmt.Errorf("unable to run pre-commit check %q: %s", check, err)
+		}
+
+		if !isTruthy(result) {
+			return fmt.Errorf("pre-commit check %q failed", check)
+		}
+	}
+
+	return nil
+}
+
+func isTruthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case []byte:
+		return isTruthy(string(v))
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			return b
+		}
+
+		n, err := strconv.ParseFloat(v, 64)
+		return err == nil && n != 0
+	default:
+		return false
+	}
+}
+
+// Init creates the version table if it does not exist yet. It is safe to call
+// it more than once. The table is created as well by any function that needs
+// it, but this allows creating it beforehand, e.g. with a user with more
+// privileges than the one running the migrations.
+func Init(db *sql.DB) error {
+	return withDatabase(db, setup)
+}
+
+// IsInitialized reports whether the version table exists in the database,
+// that is, if mig has ever been used with it. Unlike CurrentVersion, this does
+// not create the table, so it can tell apart a brand new database and one that
+// is at version 0.
+func IsInitialized(db *sql.DB) (bool, error) {
+	return versionTableExists(db)
+}
+
+func versionTableExists(db DB) (bool, error) {
+	var count int
+	if err := db.QueryRow(tableExistsQuery(dialectFor(db), tableName), execModeArgs()...).Scan(&count); err != nil {
+		return false, fmt.Errorf("unable to check if table %s exists: %s", tableName, err)
+	}
+
+	return count > 0, nil
+}
+
+// CurrentVersion returns the current version of the database. If a reader
+// was set with SetReaderDB, the version is read from it.
+func CurrentVersion(db *sql.DB) (version int64, err error) {
+	version, _, err = CurrentVersionInfo(db)
+	return version, err
+}
+
+// CurrentVersionInfo returns the current version of the database, creating
+// the version table if needed, like CurrentVersion. Besides the version, it
+// reports whether the table was already initialized, which is false if it had
+// to be created during the call. That way a brand new database can be told
+// apart from one that is at version 0.
+// If a reader was set with SetReaderDB, the version is read from it, and the
+// table is only created in db if it does not exist in the reader.
+func CurrentVersionInfo(db *sql.DB) (version int64, initialized bool, err error) {
+	return currentVersionInfo(querierOf(db), readerDB)
+}
+
+// currentVersion returns the current version of the given database, ignoring
+// the reader set with SetReaderDB. It must be used when the version is going
+// to be changed, since the reader might be lagging behind.
+func currentVersion(db Querier) (int64, error) {
+	version, _, err := currentVersionInfo(db, nil)
+	return version, err
+}
+
+func currentVersionInfo(db Querier, reader *sql.DB) (version int64, initialized bool, err error) {
+	if versionStore != nil {
+		if err = withQuerier(db, setup); err == nil {
+			version, initialized, err = storeVersionInfo()
+		}
+	} else if reader != nil {
+		err = withDatabase(reader, func(db DB) error {
+			var err error
+			initialized, err = versionTableExists(db)
+			if err != nil || !initialized {
+				return err
+			}
+
+			version, err = readVersion(db)
+			return err
+		})
+	}
+
+	if err == nil && !initialized && versionStore == nil {
+		err = withQuerier(db, func(db DB) error {
+			var err error
+			initialized, err = versionTableExists(db)
+			if err != nil {
+				return err
+			}
+
+			if err := setup(db); err != nil {
+				return err
+			}
+
+			version, err = readVersion(db)
+			return err
+		})
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	if failIfAhead && compareVersions(version, LatestVersion()) > 0 {
+		return version, initialized, ErrDatabaseAheadOfCode
+	}
+
+	return
+}
+
+// versionTable returns the name of the version table quoted for the dialect
+// of the given database.
+func versionTable(db DB) (string, error) {
+	table, err := quoteIdent(dialectFor(db), tableName)
+	if err != nil {
+		return "", fmt.Errorf("invalid version table name: %s", err)
+	}
+	return table, nil
+}
+
+// readVersion returns the latest version in the version table, which must
+// exist.
+func readVersion(db DB) (version int64, err error) {
+	table, err := versionTable(db)
+	if err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY %s DESC",
+		versionColumn, table, updatedAtColumn,
+	)
+	err = db.QueryRow(query, execModeArgs()...).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("error checking current version: %s", err)
+	}
+	return version, nil
+}
+
+// SetVersion sets the current version of the database to the given version,
+// updating the single row of the version table and appending the change to
+// the migration log along with the message set with SetRunMessage, if any.
+// If an external store was set with SetExternalStore, the version is set in
+// the store instead.
+func SetVersion(db DB, v int64) error {
+	if versionStore != nil {
+		if err := versionStore.Set(v); err != nil {
+			return fmt.Errorf("error setting version of database to %d in store: %s", v, err)
+		}
+		return nil
+	}
+
+	table, err := versionTable(db)
+	if err != nil {
+		return err
+	}
+
+	// updated_at must always increase, otherwise versions set in the same
+	// second would be impossible to tell apart
+	var last sql.NullInt64
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", updatedAtColumn, table)
+	if err := db.QueryRow(query, execModeArgs()...).Scan(&last); err != nil {
+		return fmt.Errorf("error setting version of database to %d: %s", v, err)
+	}
+
+	updatedAt, err := nextAppliedAt(db)
+	if err != nil {
+		return err
+	}
+
+	if last.Valid && last.Int64 >= updatedAt {
+		updatedAt = last.Int64 + 1
+	}
+
+	prev, err := readVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if err := setVersionRow(db, table, v, updatedAt, last.Valid); err != nil {
+		return fmt.Errorf("error setting version of database to %d: %s", v, err)
+	}
+
+	return appendLog(db, v, direction(prev, v), outcomeSuccess, updatedAt, runMessage)
+}
+
+// setVersionRow updates the single row of the version table or inserts it if
+// the table is still empty.
+func setVersionRow(db DB, table string, v, updatedAt int64, exists bool) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET %s = %d, %s = %d",
+		table, versionColumn, v, updatedAtColumn, updatedAt,
+	)
+	if !exists {
+		query = fmt.Sprintf(
+			"INSERT INTO %s (%s, %s) VALUES (%d, %d)",
+			table, versionColumn, updatedAtColumn, v, updatedAt,
+		)
+	}
+
+	_, err := db.Exec(query, execModeArgs()...)
+	return err
+}
+
+// Repair rewrites the version table so the current version of the database is
+// the one returned by detect, which should find out the real version using the
+// actual schema of the database. This is an escape hatch meant to recover the
+// version table when it got out of sync, not to be used on a regular basis.
+func Repair(db *sql.DB, detect func(db *sql.DB) (int64, error)) error {
+	if err := withDatabase(db, setup); err != nil {
+		return err
+	}
+
+	v, err := detect(db)
+	if err != nil {
+		return fmt.Errorf("unable to detect the version of the database: %s", err)
+	}
+
+	if v < 0 {
+		return fmt.Errorf("detected version %d is not valid, it must be 0 or bigger", v)
+	}
+
+	return runDatabaseTx(db, func(db DB) error {
+		return SetVersion(db, v)
+	})
+}
+
+// Compact deletes the events of the migration log with a version that goes
+// before the given one, so it does not accumulate stale rows after squashing the old
+// migrations into a single one. The events of the current version of the
+// database are never deleted, even if it goes before it. Only the
+// migration log is modified, migrations are never run.
+func Compact(db *sql.DB, before int64) error {
+	if versionStore != nil {
+		return errExternalStore
+	}
+
+	if err := withDatabase(db, setup); err != nil {
+		return err
+	}
+
+	return runDatabaseTx(db, func(db DB) error {
+		current, err := readVersion(db)
+		if err != nil {
+			return err
+		}
+
+		table, err := logTable(db)
+		if err != nil {
+			return err
+		}
+
+		rows, err := db.Query(fmt.Sprintf("SELECT DISTINCT version FROM %s", table), execModeArgs()...)
+		if err != nil {
+			return fmt.Errorf("unable to read versions of table %s: %s", logTableName(), err)
+		}
+		defer rows.Close()
+
+		// versions are compared with the comparator set with
+		// SetVersionComparator, so it can't be done in the query
+		var stale []string
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				return fmt.Errorf("unable to scan version of table %s: %s", logTableName(), err)
+			}
+
+			if v != current && compareVersions(v, before) < 0 {
+				stale = append(stale, strconv.FormatInt(v, 10))
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("unable to read versions of table %s: %s", logTableName(), err)
+		}
+		rows.Close()
+
+		if len(stale) == 0 {
+			return nil
+		}
+
+		_, err = db.Exec(fmt.Sprintf(
+			"DELETE FROM %s WHERE version IN (%s)",
+			table, strings.Join(stale, ", "),
+		), execModeArgs()...)
+		if err != nil {
+			return fmt.Errorf("unable to compact table %s: %s", logTableName(), err)
+		}
+		return nil
+	})
+}
+
+const migrationsTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+	%s bigint not null,
+	%s bigint not null
+)
+`
+
+// createTable runs the given CREATE TABLE IF NOT EXISTS query. The error of
+// the table already existing is ignored, since it's returned by some
+// databases when another instance creates the same table concurrently.
+func createTable(db DB, query, name string) error {
+	if _, err := db.Exec(query, execModeArgs()...); err != nil && !isAlreadyExists(dialectFor(db), err) {
+		return fmt.Errorf("unable to create table %s: %s", name, err)
+	}
+
+	return nil
+}
+
+func setup(db DB) error {
+	if versionStore == nil {
+		table, err := versionTable(db)
+		if err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf(migrationsTableSQL, table, versionColumn, updatedAtColumn)
+		if err := createTable(db, query, tableName); err != nil {
+			return err
+		}
+
+		if err := setupLog(db); err != nil {
+			return err
+		}
+	}
+
+	if len(deferredMigrations) > 0 {
+		if err := setupDeferred(db); err != nil {
+			return err
+		}
+	}
+
+	if hasChecksums() {
+		if err := setupChecksums(db); err != nil {
+			return err
+		}
+	}
+
+	if hasConditional() {
+		return setupSkipped(db)
+	}
+
+	return nil
+}
+
+type migration struct {
+	version int64
+	up      MigrationFunc
+	down    MigrationFunc
+	file    string
+	// upSQL and downSQL are the statements of the migration if it was loaded
+	// from SQL files.
+	upSQL   []string
+	downSQL []string
+	// irreversible is true if the migration was registered without a down
+	// on purpose.
+	irreversible bool
+	// description is a human readable description of the migration, if it
+	// was registered with RegisterDesc.
+	description string
+	// condition decides whether the migration is applied or skipped, if it
+	// was registered with RegisterConditional.
+	condition func() bool
+	// env is the only environment the migration is applied in, if it was
+	// registered with RegisterFor.
+	env string
+	// noTx is true if the migration must always run outside of a
+	// transaction.
+	noTx bool
+	// needsTx is true if the migration can only run inside a transaction,
+	// if it was registered with RegisterTxFunc.
+	needsTx bool
+	// needsDB is true if the migration needs a *sql.DB and can't run inside
+	// a transaction, if it was registered with RegisterDB.
+	needsDB bool
+	// statementTimeout is the maximum time a statement of the migration can
+	// take when it runs inside a transaction. 0 means no limit.
+	statementTimeout time.Duration
+}
+
+type byVersion []migration
+
+func (m byVersion) Len() int           { return len(m) }
+func (m byVersion) Less(i, j int) bool { return compareVersions(m[i].version, m[j].version) < 0 }
+func (m byVersion) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// scanDir returns the sorted versions of all the migration files in the given
+// directory. If strict is true, Go and SQL files that are not correctly named
+// migrations make it fail instead of being ignored. Go files are never
+// considered migrations in directories with SQL files, which can only hold
+// the Go file that embeds them.
+func scanDir(dir string, strict bool) ([]int64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get list of migrations directory files: %s", err)
+	}
+
+	sqlDir := hasSQLFiles(files)
+	var seen = make(map[int64]struct{})
+	var versions []int64
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		var v int64
+		var err error
+		if strings.HasSuffix(f.Name(), ".sql") {
+			v, err = versionFromSQLFile(f.Name())
+		} else {
+			v, err = versionFromFile(f.Name())
+		}
+
+		if err != nil {
+			if strict && isMigrationCandidate(f.Name(), sqlDir) {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			versions = append(versions, v)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	return versions, nil
+}
+
+// ValidateDir checks, without compiling or importing them, that all Go files
+// in the given migrations directory follow the NUMBER_NAME.go convention and
+// that there are no duplicated versions or gaps between them. All the
+// problems found are reported, not just the first one. Directories with SQL
+// files are not checked, since their only Go file is the one embedding them.
+func ValidateDir(dir string) []error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return []error{fmt.Errorf("unable to get list of migrations directory files: %s", err)}
+	}
+
+	if hasSQLFiles(files) {
+		return nil
+	}
+
+	var errs []error
+	var byVersion = make(map[int64][]string)
+	var versions []int64
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		v, err := versionFromFile(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if v <= 0 {
+			errs = append(errs, fmt.Errorf("version %d in file %q is not valid, it must be bigger than 0", v, name))
+			continue
+		}
+
+		if _, ok := byVersion[v]; !ok {
+			versions = append(versions, v)
+		}
+		byVersion[v] = append(byVersion[v], name)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	for i, v := range versions {
+		if names := byVersion[v]; len(names) > 1 {
+			errs = append(errs, fmt.Errorf("version %d is duplicated in files %s", v, strings.Join(names, ", ")))
+		}
+
+		if i > 0 && v != versions[i-1]+1 {
+			errs = append(errs, fmt.Errorf("there is a gap between versions %d and %d", versions[i-1], v))
+		}
+	}
+
+	return errs
+}
+
+// isMigrationCandidate reports whether the given file could be a migration
+// judging by its extension. Go files are not candidates in directories with
+// SQL files.
+func isMigrationCandidate(file string, sqlDir bool) bool {
+	if strings.HasSuffix(file, ".go") {
+		return !sqlDir && !strings.HasSuffix(file, "_test.go")
+	}
+	return strings.HasSuffix(file, ".sql")
+}
+
+// hasSQLFiles reports whether any of the given files is a SQL file.
+func hasSQLFiles(files []os.FileInfo) bool {
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".sql") {
+			return true
+		}
+	}
+	return false
+}
+
+func versionFromFile(file string) (int64, error) {
+	file = baseName(file)
+	if !strings.HasSuffix(file, ".go") {
+		return 0, fmt.Errorf("migration file %s should have .go extension", file)
+	}
+
+	if v, ok := versionPrefix(file); ok {
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("migration file name must be NUMBER_NAME.go, is %s", file)
+}
+
+// CheckDir reports all the versions that more than one migration in the given
+// directory share, e.g. 0003_add_users.go and 0003_add_index.go, which would
+// otherwise only fail once the migrations are registered. The up and down
+// files of the same SQL migration don't collide with each other. Files that
+// are not named like migrations are ignored.
+func CheckDir(dir string) []error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return []error{fmt.Errorf("unable to get list of migrations directory files: %s", err)}
+	}
+
+	var byVersion = make(map[int64][]string)
+	var seen = make(map[string]struct{})
+	var versions []int64
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		var v int64
+		var err error
+		var key = name
+		switch filepath.Ext(name) {
+		case ".go":
+			v, err = versionFromFile(name)
+		case ".sql":
+			v, err = versionFromSQLFile(name)
+			key = strings.TrimSuffix(strings.TrimSuffix(name, ".up.sql"), ".down.sql")
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if _, ok := byVersion[v]; !ok {
+			versions = append(versions, v)
+		}
+		byVersion[v] = append(byVersion[v], name)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	var errs []error
+	for _, v := range versions {
+		if names := byVersion[v]; len(names) > 1 {
+			errs = append(errs, fmt.Errorf("version %d is duplicated in files %s", v, strings.Join(names, ", ")))
+		}
+	}
+
+	return errs
+}
+
+func versionFromSQLFile(file string) (int64, error) {
+	if !strings.HasSuffix(file, ".up.sql") && !strings.HasSuffix(file, ".down.sql") {
+		return 0, fmt.Errorf("sql migration file %s should have .up.sql or .down.sql extension", file)
+	}
+
+	if v, ok := versionPrefix(file); ok {
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("sql migration file name must be NUMBER_NAME.up.sql or NUMBER_NAME.down.sql, is %s", file)
+}
+
+func versionPrefix(file string) (int64, bool) {
+	if idx := strings.IndexRune(file, '_'); idx >= 0 {
+		v, err := strconv.ParseInt(file[:idx], 10, 64)
+		if err == nil {
+			return v, true
+		}
+	}
+
+	return 0, false
+}
+
+const sqlMigrationTpl = `%spackage migrations
+
+import "github.com/erizocosmico/mig"
+
+func init() {
+	mig.Register(
+		func(db mig.DB) error {
+			%s
+		},
+		func(db mig.DB) error {
+			%s
+		},
+	)
+}
+`
+
+func renderSQLMigration(comment string, up, down []string) ([]byte, error) {
+	var header string
+	if comment != "" {
+		for _, line := range strings.Split(strings.TrimRight(comment, "\n"), "\n") {
+			header += strings.TrimRight("// "+line, " ") + "\n"
+		}
+		header += "\n"
+	}
+
+	content := fmt.Sprintf(sqlMigrationTpl, header, execAllSource(up), execAllSource(down))
+	src, err := format.Source([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("unable to render migration: %s", err)
+	}
+	return src, nil
+}
+
+// execAllSource returns the Go source to execute the given statements with
+// ExecAll.
+func execAllSource(stmts []string) string {
+	if len(stmts) == 0 {
+		return "return nil"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("return mig.ExecAll(db,\n")
+	for _, stmt := range stmts {
+		if strings.Contains(stmt, "`") {
+			buf.WriteString(strconv.Quote(stmt))
+		} else {
+			buf.WriteString("`" + stmt + "`")
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString(")")
+	return buf.String()
 }
 
 const migrationTpl = `package migrations
@@ -2,11 +2,13 @@ package mig
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -25,8 +27,10 @@ func TestCreate(t *testing.T) {
 		{"dir is not a dir", "dir", file("dir"), "", false},
 		{"no perms to create migration", "dir", dir("dir", 0000), "", false},
 		{"create dir for migration", filepath.Join("dir", "foo"), dir("dir", 0777), "0001_foo.go", true},
+		{"create nested dirs for migration", filepath.Join("db", "migrations"), dir("dir", 0777), "0001_foo.go", true},
 		{"create first migration", "dir", dir("dir", 0777), "0001_foo.go", true},
 		{"create non-first migration", "dir", dir("dir", 0777, file("0001_foo.go"), file("0002_foo.go")), "0003_foo.go", true},
+		{"create migration in mixed dir", "dir", dir("dir", 0777, file("0001_foo.go"), file("0002_foo.up.sql"), file("0002_foo.down.sql")), "0003_foo.go", true},
 	}
 
 	for _, tt := range tests {
@@ -60,6 +64,128 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateStrict(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure fileCreator
+		result    string
+		ok        bool
+	}{
+		{"valid", dir("dir", 0777, file("0001_foo.go"), file("README.md"), file("foo_test.go")), "0002_foo.go", true},
+		{"unnumbered go file", dir("dir", 0777, file("0001_foo.go"), file("draft_foo.go")), "", false},
+		{"unnumbered sql file", dir("dir", 0777, file("0001_foo.go"), file("foo.up.sql")), "", false},
+		{"sql dir with embed file", dir("dir", 0777, file("0001_foo.up.sql"), file("0001_foo.down.sql"), file("embed.go")), "0002_foo.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+			if err != nil {
+				t.Fatalf("unexpected error creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(base)
+
+			if err := tt.structure(base); err != nil {
+				t.Fatalf("unexpected error creating structure for test: %s", err)
+			}
+
+			filename, err := CreateStrict(filepath.Join(base, "dir"), "foo")
+			if err != nil && tt.ok {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && !tt.ok {
+				t.Errorf("expecting error")
+			} else if filename != tt.result {
+				t.Errorf("unexpected result:\n\t(GOT): %s\n\t(WNT): %s", filename, tt.result)
+			}
+		})
+	}
+}
+
+func TestCreate_VersionAllocator(t *testing.T) {
+	defer SetVersionAllocator(nil)
+
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	if err := dir("dir", 0777, file("0001_foo.go"))(base); err != nil {
+		t.Fatalf("unexpected error creating structure for test: %s", err)
+	}
+
+	var existing []int64
+	SetVersionAllocator(func(versions []int64) (int64, error) {
+		existing = versions
+		return 20200101, nil
+	})
+
+	filename, err := Create(filepath.Join(base, "dir"), "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if filename != "20200101_foo.go" {
+		t.Errorf("unexpected result:\n\t(GOT): %s\n\t(WNT): %s", filename, "20200101_foo.go")
+	}
+
+	if !reflect.DeepEqual(existing, []int64{1}) {
+		t.Errorf("unexpected existing versions:\n\t(GOT): %v\n\t(WNT): %v", existing, []int64{1})
+	}
+
+	// the allocated version already exists now
+	if _, err := Create(filepath.Join(base, "dir"), "bar"); err == nil {
+		t.Errorf("expecting error")
+	}
+}
+
+func TestCreateWithSQL(t *testing.T) {
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	if err := dir("dir", 0777, file("0001_foo.go"))(base); err != nil {
+		t.Fatalf("unexpected error creating structure for test: %s", err)
+	}
+
+	filename, err := CreateWithSQL(
+		filepath.Join(base, "dir"),
+		"add_bar",
+		"Generated migration.",
+		[]string{"CREATE TABLE bar (id int)", "CREATE TABLE `baz` (id int)"},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if filename != "0002_add_bar.go" {
+		t.Errorf("unexpected result:\n\t(GOT): %s\n\t(WNT): %s", filename, "0002_add_bar.go")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(base, "dir", filename))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(string(content), "// Generated migration.\n\npackage migrations") {
+		t.Errorf("expecting migration to start with the comment, got:\n%s", content)
+	}
+
+	for _, expected := range []string{
+		"return mig.ExecAll(db,",
+		"`CREATE TABLE bar (id int)`,",
+		`"CREATE TABLE ` + "`baz`" + ` (id int)",`,
+		"return nil",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expecting migration to contain %s, got:\n%s", expected, content)
+		}
+	}
+}
+
 func TestRegister_NilFunc(t *testing.T) {
 	defer reset()
 	defer func() {
@@ -127,6 +253,138 @@ func TestRegister_Valid(t *testing.T) {
 	}
 }
 
+func TestRegisterIrreversible(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(1)
+
+	mockCaller("/0002_foo.go")
+	RegisterIrreversible(newMigrationFunc(2, migrationUp, nil))
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, tx := range []bool{true, false} {
+		_, _, err := Down(db, tx)
+		if !errors.Is(err, ErrIrreversible) {
+			t.Errorf("tx=%v: expecting irreversible error, got: %v", tx, err)
+		}
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+}
+
+func TestDown_SkipIrreversible(t *testing.T) {
+	defer reset()
+	defer SetSkipIrreversible(false)
+
+	migrations = generateMigrations(3)
+	migrations[1].down = nil
+	migrations[1].irreversible = true
+
+	for _, tx := range []bool{true, false} {
+		t.Run(fmt.Sprintf("tx=%v", tx), func(t *testing.T) {
+			db, cleanup := initTest(t, 3)
+			defer cleanup()
+
+			SetSkipIrreversible(false)
+			if _, _, err := ToVersion(db, tx, 0); err == nil {
+				t.Errorf("expecting error")
+			}
+
+			db2, cleanup2 := initTest(t, 3)
+			defer cleanup2()
+
+			SetSkipIrreversible(true)
+			_, newVersion, err := ToVersion(db2, tx, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if newVersion != 0 {
+				t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 0)
+			}
+
+			assertMigration(t, []int64{3, 1}, migrationDown, db2)
+
+			warns := Warnings()
+			if len(warns) != 1 || warns[0].Version != 2 {
+				t.Errorf("expecting a warning for version 2, got: %v", warns)
+			}
+		})
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	defer reset()
+	defer SetAllowGaps(false)
+
+	migrations = generateMigrations(3)
+	migrations = append(migrations, migration{version: 4, up: emptyMigrationFunc, irreversible: true})
+	if err := ValidateRegistry(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	migrations = generateMigrations(3)
+	migrations = append(migrations,
+		migration{version: 6, up: emptyMigrationFunc, down: emptyMigrationFunc, file: "0006_foo.go"},
+	)
+	SetVersionLabels(map[int64]string{0: "empty", 3: "v1.0.0", 5: "v1.1.0"})
+
+	err := ValidateRegistry()
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	for _, msg := range []string{
+		`version 5 has label "v1.1.0"`,
+		"gap between versions 3 and 6",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expecting error to contain %q, got: %s", msg, err)
+		}
+	}
+
+	SetAllowGaps(true)
+	if err := ValidateRegistry(); err == nil || strings.Contains(err.Error(), "gap") {
+		t.Errorf("expecting error without gaps, got: %v", err)
+	}
+}
+
+func TestRegister_WindowsPath(t *testing.T) {
+	defer reset()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+
+	mockCaller(`C:\proj\migrations\0001_foo.go`)
+	Register(emptyMigrationFunc, emptyMigrationFunc)
+
+	if len(migrations) != 1 {
+		t.Fatalf("unexpected migrations:\n\t(GOT): %d\n\t(WNT): %d", len(migrations), 1)
+	}
+
+	if migrations[0].version != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", migrations[0].version, 1)
+	}
+
+	if migrations[0].file != "0001_foo.go" {
+		t.Errorf("unexpected file:\n\t(GOT): %s\n\t(WNT): %s", migrations[0].file, "0001_foo.go")
+	}
+}
+
 func TestToVersion(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -139,8 +397,10 @@ func TestToVersion(t *testing.T) {
 		{"same version", 1, 1, true, 0, nil},
 		{"up", 1, 3, true, migrationUp, []int64{2, 3}},
 		{"down", 3, 1, true, migrationDown, []int64{3, 2}},
+		{"zero", 3, 0, true, migrationDown, []int64{3, 2, 1}},
 	}
 
+	defer reset()
 	migrations = generateMigrations(3)
 
 	for _, tt := range tests {
@@ -166,6 +426,48 @@ func TestToVersion(t *testing.T) {
 	}
 }
 
+func TestLatestVersion(t *testing.T) {
+	defer reset()
+	if v := LatestVersion(); v != 0 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 0)
+	}
+
+	migrations = generateMigrations(3)
+	if v := LatestVersion(); v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+}
+
+func TestDependenciesOf(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+
+	if deps := DependenciesOf(1); len(deps) != 0 {
+		t.Errorf("unexpected dependencies:\n\t(GOT): %v\n\t(WNT): []", deps)
+	}
+
+	expected := []int64{1, 2}
+	if deps := DependenciesOf(3); !reflect.DeepEqual(deps, expected) {
+		t.Errorf("unexpected dependencies:\n\t(GOT): %v\n\t(WNT): %v", deps, expected)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(5)
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	applied, pending, err := Counts(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if applied != 3 || pending != 2 {
+		t.Errorf("unexpected counts:\n\t(GOT): %d, %d\n\t(WNT): %d, %d", applied, pending, 3, 2)
+	}
+}
+
 func TestToVersion_NotFound(t *testing.T) {
 	defer reset()
 	db, cleanup := initTest(t, 0)
@@ -210,14 +512,117 @@ func TestDown_NoMigrations(t *testing.T) {
 	}
 }
 
+func TestDown_AtBaseline(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	oldVersion, newVersion, err := Down(db, true)
+	if err != ErrAlreadyAtBaseline {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrAlreadyAtBaseline)
+	}
+
+	if oldVersion != 0 || newVersion != 0 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 0, 0", oldVersion, newVersion)
+	}
+
+	assertMigration(t, nil, migrationDown, db)
+}
+
+func TestToVersion_Zero(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+
+	tests := []struct {
+		name       string
+		oldVersion int64
+		expected   []int64
+	}{
+		{"from latest", 3, []int64{3, 2, 1}},
+		{"from first", 1, []int64{1}},
+		{"already at zero", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := initTest(t, tt.oldVersion)
+			defer cleanup()
+
+			oldVersion, newVersion, err := ToVersion(db, true, 0)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			if oldVersion != tt.oldVersion {
+				t.Errorf("unexpected old version:\n\t(GOT): %d\n\t(WNT): %d", oldVersion, tt.oldVersion)
+			}
+
+			if newVersion != 0 {
+				t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 0)
+			}
+
+			assertMigration(t, tt.expected, migrationDown, db)
+		})
+	}
+}
+
+func TestUp_NoPendingMigrations(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	_, _, err := Up(db, true)
+	if err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
+
+func TestOnNoChange(t *testing.T) {
+	defer reset()
+	defer SetOnNoChange(nil)
+
+	var calls []int64
+	SetOnNoChange(func(version int64) {
+		calls = append(calls, version)
+	})
+
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 2)
+	defer cleanup()
+
+	if _, _, err := ToVersion(db, true, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	oldVersion, newVersion, err := Up(db, true)
+	if err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+
+	if oldVersion != 3 || newVersion != 3 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 3, 3", oldVersion, newVersion)
+	}
+
+	expected := []int64{2, 3}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected calls:\n\t(GOT): %v\n\t(WNT): %v", calls, expected)
+	}
+}
+
 func TestDown_ErrorMigration(t *testing.T) {
 	defer reset()
 	migrations = []migration{
 		{
-			2,
-			newMigrationFunc(2, migrationUp, fmt.Errorf("err")),
-			newMigrationFunc(2, migrationDown, fmt.Errorf("err")),
-			"2_test.go",
+			version: 2,
+			up:      newMigrationFunc(2, migrationUp, fmt.Errorf("err")),
+			down:    newMigrationFunc(2, migrationDown, fmt.Errorf("err")),
+			file:    "2_test.go",
 		},
 	}
 
@@ -266,36 +671,333 @@ func TestUp(t *testing.T) {
 	assertMigration(t, []int64{1, 2, 3}, migrationUp, db)
 }
 
-func TestUp_FromStartpoint(t *testing.T) {
+func TestUpFrom(t *testing.T) {
 	defer reset()
-	migrations = generateMigrations(3)
-	db, cleanup := initTest(t, 1)
+	migrations = generateMigrations(4)
+	db, cleanup := initTest(t, 3)
 	defer cleanup()
 
-	oldVersion, newVersion, err := Up(db, true)
+	oldVersion, newVersion, err := UpFrom(db, true, 1, true)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
 
-	if oldVersion != 1 {
-		t.Errorf("unexpected old version:\n\t(GOT): %d\n\t(WNT): %d", oldVersion, 1)
+	if oldVersion != 3 || newVersion != 4 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 3, 4", oldVersion, newVersion)
 	}
 
-	if newVersion != 3 {
-		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 3)
+	assertMigration(t, []int64{2, 3, 4}, migrationUp, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
 	}
 
-	assertMigration(t, []int64{2, 3}, migrationUp, db)
+	if v != 4 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 4)
+	}
 }
 
-func TestUp_NoMigrations(t *testing.T) {
+func TestUpFrom_NoRecord(t *testing.T) {
 	defer reset()
-	db, cleanup := initTest(t, 0)
+	migrations = generateMigrations(4)
+	db, cleanup := initTest(t, 3)
 	defer cleanup()
 
-	_, _, err := Up(db, true)
-	if err == nil {
-		t.Errorf("expecting an error")
+	oldVersion, newVersion, err := UpFrom(db, true, 1, false)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 3 || newVersion != 4 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 3, 4", oldVersion, newVersion)
+	}
+
+	assertMigration(t, []int64{2, 3, 4}, migrationUp, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+}
+
+func TestUpFrom_Error(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(4)
+	migrations[2].up = newMigrationFunc(3, migrationUp, errors.New("boom"))
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	oldVersion, _, err := UpFrom(db, true, 0, true)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if oldVersion != 1 {
+		t.Errorf("unexpected old version:\n\t(GOT): %d\n\t(WNT): %d", oldVersion, 1)
+	}
+}
+
+func TestReapply(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(4)
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	if err := Reapply(db, true, 2, 3); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{2, 3}, migrationUp, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+
+	if err := Reapply(db, true, 3, 2); err == nil {
+		t.Errorf("expecting an error with an invalid range")
+	}
+
+	if err := Reapply(db, true, 5, 8); err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
+
+func TestUpAfter(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(5)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	oldVersion, newVersion, err := UpAfter(db, true, 3)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 1 || newVersion != 5 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 1, 5", oldVersion, newVersion)
+	}
+
+	assertMigration(t, []int64{4, 5}, migrationUp, db)
+
+	if _, _, err := UpAfter(db, true, 2); err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
+
+func TestUpOne(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	oldVersion, newVersion, err := UpOne(db, true)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 1 || newVersion != 2 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 1, 2", oldVersion, newVersion)
+	}
+
+	assertMigration(t, []int64{2}, migrationUp, db)
+}
+
+func TestUpOne_NoPendingMigrations(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	_, _, err := UpOne(db, true)
+	if err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
+
+func TestResume(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(4)
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("failed"))
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Resume(db, false); err == nil {
+		t.Errorf("expecting error resuming without a failed migration")
+	}
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	oldVersion, newVersion, err := Resume(db, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 1 || newVersion != 4 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): %d, %d", oldVersion, newVersion, 1, 4)
+	}
+
+	// 2 was completed manually, so it must not run again
+	assertMigration(t, []int64{1, 2, 3, 4}, migrationUp, db)
+
+	if _, _, err := Resume(db, false); err == nil {
+		t.Errorf("expecting error resuming twice")
+	}
+}
+
+func TestResume_NotNext(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	migrations[2].up = newMigrationFunc(3, migrationUp, errors.New("failed"))
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	// the version is rolled back after the failure, so the failed migration
+	// is no longer the next pending one
+	if err := SetVersion(db, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Resume(db, false); err == nil {
+		t.Errorf("expecting error resuming from a migration that is not the next one")
+	}
+}
+
+func TestResume_VersionRecorded(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("failed"))
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if err := SetVersion(db, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	oldVersion, newVersion, err := Resume(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 2 || newVersion != 3 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): %d, %d", oldVersion, newVersion, 2, 3)
+	}
+
+	assertMigration(t, []int64{1, 2, 3}, migrationUp, db)
+}
+
+func TestResume_Last(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(2)
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("failed"))
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	_, newVersion, err := Resume(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if newVersion != 2 {
+		t.Errorf("unexpected new version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 2)
+	}
+
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+}
+
+func TestUp_MaxBatch(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(5)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	SetMaxBatch(2)
+
+	expected := []struct {
+		version int64
+		pending int
+	}{
+		{2, 3},
+		{4, 1},
+		{5, 0},
+	}
+
+	for _, e := range expected {
+		_, newVersion, err := Up(db, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if newVersion != e.version {
+			t.Errorf("unexpected new version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, e.version)
+		}
+
+		_, pending, err := Counts(db)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if pending != e.pending {
+			t.Errorf("unexpected pending migrations:\n\t(GOT): %d\n\t(WNT): %d", pending, e.pending)
+		}
+	}
+
+	assertMigration(t, []int64{1, 2, 3, 4, 5}, migrationUp, db)
+}
+
+func TestUp_FromStartpoint(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	oldVersion, newVersion, err := Up(db, true)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 1 {
+		t.Errorf("unexpected old version:\n\t(GOT): %d\n\t(WNT): %d", oldVersion, 1)
+	}
+
+	if newVersion != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 3)
+	}
+
+	assertMigration(t, []int64{2, 3}, migrationUp, db)
+}
+
+func TestUp_NoMigrations(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	_, _, err := Up(db, true)
+	if err == nil {
+		t.Errorf("expecting an error")
 	}
 }
 
@@ -303,31 +1005,32 @@ func TestUp_ErrorMigration(t *testing.T) {
 	defer reset()
 	migrations = []migration{
 		{
-			1,
-			newMigrationFunc(1, migrationUp, nil),
-			newMigrationFunc(1, migrationDown, nil),
-			"1_test.go",
+			version: 1,
+			up:      newMigrationFunc(1, migrationUp, nil),
+			down:    newMigrationFunc(1, migrationDown, nil),
+			file:    "1_test.go",
 		},
 		{
-			2,
-			newMigrationFunc(2, migrationUp, fmt.Errorf("err")),
-			newMigrationFunc(2, migrationDown, fmt.Errorf("err")),
-			"2_test.go",
+			version: 2,
+			up:      newMigrationFunc(2, migrationUp, fmt.Errorf("err")),
+			down:    newMigrationFunc(2, migrationDown, fmt.Errorf("err")),
+			file:    "2_test.go",
 		},
 		{
-			3,
-			newMigrationFunc(3, migrationUp, nil),
-			newMigrationFunc(3, migrationDown, nil),
-			"3_test.go",
+			version: 3,
+			up:      newMigrationFunc(3, migrationUp, nil),
+			down:    newMigrationFunc(3, migrationDown, nil),
+			file:    "3_test.go",
 		},
 	}
 
 	tests := []struct {
 		tx       bool
 		expected []int64
+		version  int64
 	}{
-		{true, nil},
-		{false, []int64{1, 2}},
+		{true, nil, 0},
+		{false, []int64{1, 2}, 1},
 	}
 
 	for _, tt := range tests {
@@ -341,19 +1044,266 @@ func TestUp_ErrorMigration(t *testing.T) {
 			}
 
 			assertMigration(t, tt.expected, migrationUp, db)
+
+			v, err := CurrentVersion(db)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if v != tt.version {
+				t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, tt.version)
+			}
 		})
 	}
 }
 
+func TestUp_RollbackError(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(2)
+	migrations[1].up = func(db DB) error {
+		// rolling back the transaction here makes the rollback of mig fail
+		if err := db.(*sql.Tx).Rollback(); err != nil {
+			return err
+		}
+		return fmt.Errorf("migration error")
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	_, _, err := Up(db, true)
+	if err == nil {
+		t.Fatalf("expecting an error")
+	}
+
+	for _, msg := range []string{"migration error", "unable to rollback"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expecting error to contain %q, got: %s", msg, err)
+		}
+	}
+}
+
+func TestUp_PreCommitChecks(t *testing.T) {
+	defer reset()
+	defer SetPreCommitChecks(nil)
+	migrations = generateMigrations(3)
+
+	tests := []struct {
+		name     string
+		checks   []string
+		ok       bool
+		expected []int64
+	}{
+		{"no checks", nil, true, []int64{1, 2, 3}},
+		{"passing checks", []string{
+			"SELECT COUNT(*) = 3 FROM migrations_run",
+			"SELECT 'true'",
+		}, true, []int64{1, 2, 3}},
+		{"failing check", []string{
+			"SELECT 1",
+			"SELECT COUNT(*) = 2 FROM migrations_run",
+		}, false, nil},
+		{"invalid check", []string{"SELECT FROM"}, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := initTest(t, 0)
+			defer cleanup()
+
+			SetPreCommitChecks(tt.checks)
+			_, _, err := Up(db, true)
+			if err != nil && tt.ok {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && !tt.ok {
+				t.Errorf("expecting error")
+			}
+
+			assertMigration(t, tt.expected, migrationUp, db)
+		})
+	}
+}
+
+func TestToVersion_DownNoTxPartialProgress(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	migrations[0].down = newMigrationFunc(1, migrationDown, fmt.Errorf("err"))
+
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	_, _, err := ToVersion(db, false, 0)
+	if err == nil {
+		t.Errorf("expected error")
+	}
+
+	assertMigration(t, []int64{3, 2, 1}, migrationDown, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+}
+
+func TestUp_FailIfAhead(t *testing.T) {
+	defer reset()
+	defer SetFailIfAhead(false)
+	migrations = generateMigrations(3)
+
+	db, cleanup := initTest(t, 5)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+
+	SetFailIfAhead(true)
+	if _, _, err := Up(db, true); err != ErrDatabaseAheadOfCode {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrDatabaseAheadOfCode)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != ErrDatabaseAheadOfCode {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrDatabaseAheadOfCode)
+	}
+
+	if v != 5 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 5)
+	}
+}
+
+func TestUp_Warnings(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	migrations[1].up = func(db DB) error {
+		Warn("skipped %d malformed rows", 3)
+		return nil
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Warning{{2, "skipped 3 malformed rows"}}
+	if w := Warnings(); !reflect.DeepEqual(w, expected) {
+		t.Errorf("unexpected warnings:\n\t(GOT): %v\n\t(WNT): %v", w, expected)
+	}
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if w := Warnings(); len(w) != 0 {
+		t.Errorf("unexpected warnings after another run: %v", w)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	db, cleanup := initTest(t, 5)
+	defer cleanup()
+
+	err := Repair(db, func(*sql.DB) (int64, error) {
+		return 3, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+
+	var count int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 1 {
+		t.Errorf("unexpected number of rows:\n\t(GOT): %d\n\t(WNT): %d", count, 1)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	for _, v := range []int64{1, 2, 3, 4, 5, 2} {
+		if err := SetVersion(db, v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := Compact(db, 4); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var versions []int64
+	for _, e := range entries {
+		versions = append(versions, e.Version)
+	}
+
+	expected := []int64{2, 4, 5, 2}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("unexpected versions:\n\t(GOT): %v\n\t(WNT): %v", versions, expected)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+}
+
+func TestRepair_DetectError(t *testing.T) {
+	db, cleanup := initTest(t, 5)
+	defer cleanup()
+
+	err := Repair(db, func(*sql.DB) (int64, error) {
+		return 0, fmt.Errorf("err")
+	})
+	if err == nil {
+		t.Errorf("expecting an error")
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 5 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 5)
+	}
+}
+
 func generateMigrations(n int64) []migration {
 	var migrations = make([]migration, int(n))
 	for i := 0; i < int(n); i++ {
 		j := int64(i + 1)
 		migrations[i] = migration{
-			j,
-			newMigrationFunc(j, migrationUp, nil),
-			newMigrationFunc(j, migrationDown, nil),
-			fmt.Sprintf("%d_test.go", j),
+			version: j,
+			up:      newMigrationFunc(j, migrationUp, nil),
+			down:    newMigrationFunc(j, migrationDown, nil),
+			file:    fmt.Sprintf("%d_test.go", j),
 		}
 	}
 	return migrations
@@ -391,6 +1341,74 @@ func assertMigration(t *testing.T, expected []int64, typ int, db *sql.DB) {
 	}
 }
 
+func TestSetColumnNames(t *testing.T) {
+	defer reset()
+	if err := SetColumnNames("v", "changed_at"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM __version WHERE v = 2 AND changed_at > 0").Scan(&count)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 1 {
+		t.Errorf("unexpected count:\n\t(GOT): %d\n\t(WNT): %d", count, 1)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+
+	history, err := ExportHistory(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(history) != 3 {
+		t.Errorf("unexpected history length:\n\t(GOT): %d\n\t(WNT): %d", len(history), 3)
+	}
+}
+
+func TestSetColumnNames_Invalid(t *testing.T) {
+	defer reset()
+	cases := [][2]string{
+		{"", "updated_at"},
+		{"version", "updated at"},
+		{"version;", "updated_at"},
+		{"1version", "updated_at"},
+		{"version", "version"},
+	}
+
+	for _, c := range cases {
+		if err := SetColumnNames(c[0], c[1]); err == nil {
+			t.Errorf("expecting error for columns %q and %q", c[0], c[1])
+		}
+	}
+
+	if versionColumn != "version" || updatedAtColumn != "updated_at" {
+		t.Errorf("column names should not change on error, got %q and %q", versionColumn, updatedAtColumn)
+	}
+}
+
 func TestVersionFromFile(t *testing.T) {
 	tests := []struct {
 		file    string
@@ -403,6 +1421,8 @@ func TestVersionFromFile(t *testing.T) {
 		{"00016_foo.go", 16, true},
 		{"foo.go", 0, false},
 		{"00001_foo.sql", 0, false},
+		{`C:\proj\migrations\0002_foo.go`, 2, true},
+		{"/proj/migrations/0003_foo.go", 3, true},
 	}
 
 	for _, tt := range tests {
@@ -419,6 +1439,194 @@ func TestVersionFromFile(t *testing.T) {
 	}
 }
 
+func TestVersionFromSQLFile(t *testing.T) {
+	tests := []struct {
+		file    string
+		version int64
+		ok      bool
+	}{
+		{"00001_foo.up.sql", 1, true},
+		{"00016_foo.down.sql", 16, true},
+		{"00001_foo.sql", 0, false},
+		{"foo.up.sql", 0, false},
+		{"00001_foo.go", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			v, err := versionFromSQLFile(tt.file)
+			if err != nil && tt.ok {
+				t.Error("unexpected error")
+			} else if err == nil && !tt.ok {
+				t.Error("expecting error")
+			} else if tt.version != v {
+				t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, tt.version)
+			}
+		})
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure fileCreator
+		strict    bool
+		result    []int64
+		ok        bool
+	}{
+		{"go and sql", dir("dir", 0777,
+			file("0003_baz.go"),
+			file("0001_foo.go"),
+			file("0002_bar.up.sql"),
+			file("0002_bar.down.sql"),
+			file("0004_qux.down.sql"),
+			file("README.md"),
+			file("draft.go"),
+			dir("0005_nested", 0777),
+		), false, []int64{1, 2, 3, 4}, true},
+		{"strict", dir("dir", 0777, file("0002_bar.go"), file("0001_foo.go"), file("foo_test.go")), true, []int64{1, 2}, true},
+		{"strict unnumbered go file", dir("dir", 0777, file("0001_foo.go"), file("draft.go")), true, nil, false},
+		{"strict unnumbered sql file", dir("dir", 0777, file("0001_foo.up.sql"), file("foo.up.sql")), true, nil, false},
+		{"strict sql dir with embed file", dir("dir", 0777, file("0001_foo.up.sql"), file("embed.go")), true, []int64{1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+			if err != nil {
+				t.Fatalf("unexpected error creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(base)
+
+			if err := tt.structure(base); err != nil {
+				t.Fatalf("unexpected error creating structure for test: %s", err)
+			}
+
+			versions, err := scanDir(filepath.Join(base, "dir"), tt.strict)
+			if err != nil && tt.ok {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && !tt.ok {
+				t.Errorf("expecting error")
+			} else if !reflect.DeepEqual(versions, tt.result) {
+				t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", versions, tt.result)
+			}
+		})
+	}
+}
+
+func TestValidateDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure fileCreator
+		errors    int
+	}{
+		{"valid", dir("dir", 0777, file("0001_foo.go"), file("0002_bar.go"), file("README.md")), 0},
+		{"empty", dir("dir", 0777), 0},
+		{"invalid name", dir("dir", 0777, file("0001_foo.go"), file("draft.go")), 1},
+		{"invalid version", dir("dir", 0777, file("0000_foo.go"), file("0001_bar.go")), 1},
+		{"duplicated", dir("dir", 0777, file("0001_foo.go"), file("0001_bar.go")), 1},
+		{"gap", dir("dir", 0777, file("0001_foo.go"), file("0003_bar.go")), 1},
+		{"sql dir with embed file", dir("dir", 0777, file("0001_foo.up.sql"), file("embed.go")), 0},
+		{"all problems", dir("dir", 0777,
+			file("0001_foo.go"),
+			file("0001_bar.go"),
+			file("0004_baz.go"),
+			file("foo.go"),
+		), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+			if err != nil {
+				t.Fatalf("unexpected error creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(base)
+
+			if err := tt.structure(base); err != nil {
+				t.Fatalf("unexpected error creating structure for test: %s", err)
+			}
+
+			errs := ValidateDir(filepath.Join(base, "dir"))
+			if len(errs) != tt.errors {
+				t.Errorf("unexpected errors:\n\t(GOT): %v\n\t(WNT): %d errors", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestValidateDir_NotExists(t *testing.T) {
+	if errs := ValidateDir(filepath.Join(os.TempDir(), "mig-does-not-exist")); len(errs) != 1 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure fileCreator
+		errors    int
+	}{
+		{"valid", dir("dir", 0777, file("0001_foo.go"), file("0002_bar.go"), file("README.md")), 0},
+		{"sql pair", dir("dir", 0777, file("0001_foo.up.sql"), file("0001_foo.down.sql"), file("0002_bar.go")), 0},
+		{"duplicated go", dir("dir", 0777, file("0003_add_users.go"), file("0003_add_index.go")), 1},
+		{"duplicated sql", dir("dir", 0777, file("0001_foo.up.sql"), file("0001_bar.up.sql")), 1},
+		{"go and sql", dir("dir", 0777, file("0001_foo.go"), file("0001_foo.up.sql"), file("0001_foo.down.sql")), 1},
+		{"all collisions", dir("dir", 0777,
+			file("0001_foo.go"),
+			file("0001_bar.go"),
+			file("0002_baz.go"),
+			file("0003_qux.go"),
+			file("0003_quux.go"),
+			file("0003_corge.go"),
+		), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+			if err != nil {
+				t.Fatalf("unexpected error creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(base)
+
+			if err := tt.structure(base); err != nil {
+				t.Fatalf("unexpected error creating structure for test: %s", err)
+			}
+
+			errs := CheckDir(filepath.Join(base, "dir"))
+			if len(errs) != tt.errors {
+				t.Errorf("unexpected errors:\n\t(GOT): %v\n\t(WNT): %d errors", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestCreate_Collisions(t *testing.T) {
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	if err := dir("dir", 0777, file("0001_foo.go"), file("0001_bar.go"))(base); err != nil {
+		t.Fatalf("unexpected error creating structure for test: %s", err)
+	}
+
+	_, err = Create(filepath.Join(base, "dir"), "baz")
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if !strings.Contains(err.Error(), "version 1 is duplicated") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(base, "dir", "0002_baz.go")); !os.IsNotExist(err) {
+		t.Errorf("expecting migration file not to be created")
+	}
+}
+
 const (
 	migrationUp   = 0
 	migrationDown = 1
@@ -459,8 +1667,51 @@ func initTest(t *testing.T, version int64) (*sql.DB, func()) {
 
 func reset() {
 	migrations = nil
+	deferredMigrations = nil
+	fixtures = nil
+	seeds = nil
+	versionColumn = "version"
+	updatedAtColumn = "updated_at"
+	allowGaps = false
+	skipIrreversible = false
+	requireTx = false
+	preflight = nil
+	maxBatch = 0
+	environment = ""
+	versionLabels = nil
+	runMessage = ""
+	disableForeignKeys = false
+	versionComparator = NumericComparator{}
+	versionStore = nil
+	checkpointEvery = 0
+	protectVersionTable = false
+	allowDirty = false
+	tableName = "__version"
+	preCommitChecks = nil
+	failIfAhead = false
+	onNoChange = nil
+	slowThreshold = 0
+	logger = nopLogger{}
+	tracer = nil
+	statementHook = nil
+	resultInspector = nil
+	sqlValidator = nil
+	schemaDumper = nil
+	historyFile = ""
+	readerDB = nil
+	dialect = ""
+	detectedDialect = ""
+	execMode = nil
+	databaseName = ""
+	lockTimeout = 0
+	versionAllocator = nextVersion
+	caller = defaultCaller
 }
 
+// defaultCaller is the caller function before tests replace it with
+// mockCaller.
+var defaultCaller = caller
+
 func emptyMigrationFunc(DB) error {
 	return nil
 }
@@ -0,0 +1,269 @@
+// Package migtest provides helpers to test migrations without a real
+// database.
+package migtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Statement is a statement run through a MockDB.
+type Statement struct {
+	// Query is the SQL of the statement.
+	Query string
+	// Args are the arguments passed along with the query.
+	Args []interface{}
+}
+
+// Result is what a MockDB returns for a statement.
+type Result struct {
+	// Columns are the names of the columns of the rows returned by Query and
+	// QueryRow.
+	Columns []string
+	// Rows are the rows returned by Query and QueryRow. Values can be of any
+	// type that can be converted to a driver.Value, e.g. int, string or
+	// time.Time.
+	Rows [][]interface{}
+	// RowsAffected is the number of rows affected returned by Exec.
+	RowsAffected int64
+	// LastInsertId is the last inserted id returned by Exec.
+	LastInsertId int64
+	// Err is the error returned by the statement. For QueryRow it's returned
+	// by Scan.
+	Err error
+}
+
+// MockDB is a mig.DB that records the statements run through it instead of
+// executing them, returning the results set with On, so tests can assert the
+// exact SQL their migrations produce:
+//
+//	db := migtest.NewMockDB()
+//	defer db.Close()
+//
+//	if err := myMigration(db); err != nil {
+//		t.Fatal(err)
+//	}
+//
+//	queries := db.Queries()
+//
+// Statements with no result set succeed without affecting nor returning any
+// row. A MockDB is safe for concurrent use.
+type MockDB struct {
+	db *sql.DB
+
+	mut        sync.Mutex
+	statements []Statement
+	results    map[string]Result
+}
+
+// NewMockDB returns a new MockDB with no results set. It must be closed with
+// Close once it's no longer used.
+func NewMockDB() *MockDB {
+	m := &MockDB{results: make(map[string]Result)}
+	m.db = sql.OpenDB(connector{m})
+	return m
+}
+
+// On sets the result returned for the statements whose query is exactly the
+// given one, replacing the previous one, if any.
+func (m *MockDB) On(query string, result Result) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.results[query] = result
+}
+
+// Statements returns all the statements run so far, in the order they were
+// run.
+func (m *MockDB) Statements() []Statement {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]Statement, len(m.statements))
+	copy(result, m.statements)
+	return result
+}
+
+// Queries returns the queries of all the statements run so far, in the order
+// they were run.
+func (m *MockDB) Queries() []string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]string, len(m.statements))
+	for i, s := range m.statements {
+		result[i] = s.Query
+	}
+	return result
+}
+
+// Reset forgets all the statements run so far. Results set with On are kept.
+func (m *MockDB) Reset() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.statements = nil
+}
+
+// Close releases the resources of the MockDB.
+func (m *MockDB) Close() error {
+	return m.db.Close()
+}
+
+// Exec records the given statement and returns the result set for it.
+func (m *MockDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	m.record(query, args)
+	return m.db.Exec(query, args...)
+}
+
+// Query records the given statement and returns the rows set for it.
+func (m *MockDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	m.record(query, args)
+	return m.db.Query(query, args...)
+}
+
+// QueryRow records the given statement and returns the first row set for it.
+func (m *MockDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	m.record(query, args)
+	return m.db.QueryRow(query, args...)
+}
+
+func (m *MockDB) record(query string, args []interface{}) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.statements = append(m.statements, Statement{query, args})
+}
+
+func (m *MockDB) result(query string) Result {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.results[query]
+}
+
+// connector, conn and stmt are a minimal database/sql driver that returns the
+// results set in a MockDB, since *sql.Rows and *sql.Row can only be created
+// by database/sql.
+type connector struct {
+	m *MockDB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return conn{c.m}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return mockDriver{}
+}
+
+type mockDriver struct{}
+
+func (mockDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("migtest: use NewMockDB to create a MockDB")
+}
+
+type conn struct {
+	m *MockDB
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	return stmt{c.m, query}, nil
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (conn) CheckNamedValue(*driver.NamedValue) error {
+	// arguments are recorded by MockDB and never used by the driver, so
+	// any value is accepted
+	return nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type stmt struct {
+	m     *MockDB
+	query string
+}
+
+func (s stmt) Close() error {
+	return nil
+}
+
+func (s stmt) NumInput() int {
+	return -1
+}
+
+func (s stmt) Exec([]driver.Value) (driver.Result, error) {
+	r := s.m.result(s.query)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return result{r.LastInsertId, r.RowsAffected}, nil
+}
+
+func (s stmt) Query([]driver.Value) (driver.Rows, error) {
+	r := s.m.result(s.query)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	values := make([][]driver.Value, len(r.Rows))
+	for i, row := range r.Rows {
+		values[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			var err error
+			values[i][j], err = driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &rows{columns: r.Columns, values: values}, nil
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,116 @@
+package migtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/erizocosmico/mig"
+)
+
+var _ mig.DB = (*MockDB)(nil)
+
+func TestMockDB_ExecAll(t *testing.T) {
+	db := NewMockDB()
+	defer db.Close()
+
+	err := mig.ExecAll(db,
+		"CREATE TABLE a (id INT)",
+		"CREATE TABLE b (id INT)",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := mig.DropAll(db, "b", "a"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		"CREATE TABLE a (id INT)",
+		"CREATE TABLE b (id INT)",
+		"DROP TABLE b",
+		"DROP TABLE a",
+	}
+
+	if queries := db.Queries(); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("unexpected queries:\n\t(GOT): %v\n\t(WNT): %v", queries, expected)
+	}
+}
+
+func TestMockDB_Exec(t *testing.T) {
+	db := NewMockDB()
+	defer db.Close()
+
+	db.On("UPDATE a SET id = ?", Result{RowsAffected: 3})
+	db.On("DELETE FROM a", Result{Err: errors.New("boom")})
+
+	res, err := db.Exec("UPDATE a SET id = ?", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("unexpected rows affected:\n\t(GOT): %d\n\t(WNT): %d", n, 3)
+	}
+
+	if _, err := db.Exec("DELETE FROM a"); err == nil || err.Error() != "boom" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := []Statement{
+		{"UPDATE a SET id = ?", []interface{}{1}},
+		{"DELETE FROM a", nil},
+	}
+
+	if stmts := db.Statements(); !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected statements:\n\t(GOT): %v\n\t(WNT): %v", stmts, expected)
+	}
+
+	db.Reset()
+	if stmts := db.Statements(); len(stmts) != 0 {
+		t.Errorf("unexpected statements after reset: %v", stmts)
+	}
+}
+
+func TestMockDB_Query(t *testing.T) {
+	db := NewMockDB()
+	defer db.Close()
+
+	db.On("SELECT id, name FROM a", Result{
+		Columns: []string{"id", "name"},
+		Rows: [][]interface{}{
+			{1, "foo"},
+			{2, "bar"},
+		},
+	})
+
+	rows, err := db.Query("SELECT id, name FROM a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"foo", "bar"}) {
+		t.Errorf("unexpected names:\n\t(GOT): %v\n\t(WNT): %v", names, []string{"foo", "bar"})
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id, name FROM a LIMIT 0").Scan(&id); err == nil {
+		t.Errorf("expecting error scanning a query with no result set")
+	}
+}
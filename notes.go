@@ -0,0 +1,68 @@
+package mig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RegisterDesc adds a new migration with a human readable description of the
+// change it makes to the schema, which is used to generate release notes with
+// ReleaseNotes. Other than that, it works exactly like Register and must be
+// called from a migration file as well.
+func RegisterDesc(desc string, up, down MigrationFunc, opts ...Option) {
+	if up == nil || down == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version:     v,
+		up:          up,
+		down:        down,
+		file:        file,
+		description: strings.TrimSpace(desc),
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// Description returns the description of the migration with the given
+// version, or an empty string if it has none or there is no such migration.
+func Description(version int64) string {
+	for _, m := range migrations {
+		if m.version == version {
+			return m.description
+		}
+	}
+	return ""
+}
+
+// ReleaseNotes returns a human readable list with the description of every
+// migration whose version goes after from and not after to, in order. The name of the migration file is used for the migrations registered
+// without a description.
+func ReleaseNotes(from, to int64) string {
+	var buf strings.Builder
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, from) <= 0 || compareVersions(m.version, to) > 0 {
+			continue
+		}
+
+		desc := m.description
+		if desc == "" {
+			desc = migrationName(m.file)
+		}
+
+		fmt.Fprintf(&buf, "- %d: %s\n", m.version, desc)
+	}
+	return buf.String()
+}
@@ -0,0 +1,33 @@
+package mig
+
+import "testing"
+
+func TestReleaseNotes(t *testing.T) {
+	defer reset()
+
+	mockCaller("/0001_create_users.go")
+	RegisterDesc("Add the users table", emptyMigrationFunc, emptyMigrationFunc)
+
+	mockCaller("/0002_create_posts.go")
+	Register(emptyMigrationFunc, emptyMigrationFunc)
+
+	mockCaller("/0003_add_avatar.go")
+	RegisterDesc("  Add an avatar to users\n", emptyMigrationFunc, emptyMigrationFunc)
+
+	expected := "- 2: create_posts\n- 3: Add an avatar to users\n"
+	if notes := ReleaseNotes(1, 3); notes != expected {
+		t.Errorf("unexpected release notes:\n\t(GOT): %q\n\t(WNT): %q", notes, expected)
+	}
+
+	if notes := ReleaseNotes(3, 3); notes != "" {
+		t.Errorf("expecting no release notes, got %q", notes)
+	}
+
+	if desc := Description(1); desc != "Add the users table" {
+		t.Errorf("unexpected description:\n\t(GOT): %s\n\t(WNT): %s", desc, "Add the users table")
+	}
+
+	if desc := Description(2); desc != "" {
+		t.Errorf("expecting no description, got %q", desc)
+	}
+}
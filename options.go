@@ -0,0 +1,110 @@
+package mig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option changes how a registered migration is run.
+type Option func(*migration)
+
+// WithStatementTimeout makes every statement of the migration fail if it
+// takes longer than the given duration, cancelling the work in the server.
+// It only applies when the migration runs inside a transaction and the
+// database supports it, which currently is only PostgreSQL. In the rest of
+// cases it has no effect.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(m *migration) {
+		m.statementTimeout = d
+	}
+}
+
+// run runs the given up or down of the migration with the migration options
+// applied.
+func (m migration) run(db DB, tx bool, fn MigrationFunc) error {
+	query := statementTimeoutQuery(dialectFor(db), m.statementTimeout)
+	if !tx || query == "" {
+		return fn(protect(db))
+	}
+
+	// SET LOCAL lasts until the end of the transaction, so the previous
+	// value is restored to not affect the migrations that run after this one
+	var prev string
+	if err := db.QueryRow("SHOW statement_timeout", execModeArgs()...).Scan(&prev); err != nil {
+		return fmt.Errorf("unable to read statement timeout: %s", err)
+	}
+
+	if _, err := db.Exec(query, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to set statement timeout: %s", err)
+	}
+
+	if err := fn(protect(db)); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf("SET LOCAL statement_timeout = %s", quoteString(prev))
+	if _, err := db.Exec(query, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to restore statement timeout: %s", err)
+	}
+	return nil
+}
+
+// statementTimeoutQuery returns the query to limit the duration of the
+// statements run in the current transaction, or an empty string if the
+// dialect does not support it or there is no limit.
+func statementTimeoutQuery(d Dialect, timeout time.Duration) string {
+	if timeout <= 0 || d != Postgres {
+		return ""
+	}
+
+	ms := int64(timeout / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)
+}
+
+// NoTransaction makes the migration always run outside of a transaction, for
+// statements that can't run inside one, such as CREATE INDEX CONCURRENTLY in
+// PostgreSQL. When migrations are run inside a transaction, the ones before
+// and after it are run in their own separate transactions.
+func NoTransaction() Option {
+	return func(m *migration) {
+		m.noTx = true
+	}
+}
+
+var requireTx bool
+
+// SetRequireTx sets whether running migrations must fail if any of the
+// pending migrations was registered with NoTransaction, for environments
+// that insist on every migration being atomic.
+func SetRequireTx(require bool) {
+	requireTx = require
+}
+
+// checkRequireTx returns an error listing the given migrations that would run
+// outside of a transaction if a transaction is required.
+func checkRequireTx(migrations []migration) error {
+	if !requireTx {
+		return nil
+	}
+
+	var versions []string
+	for _, m := range migrations {
+		if m.noTx {
+			versions = append(versions, strconv.FormatInt(m.version, 10))
+		}
+	}
+
+	if len(versions) > 0 {
+		return fmt.Errorf(
+			"a transaction is required but migrations %s can not run inside one",
+			strings.Join(versions, ", "),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package mig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatementTimeoutQuery(t *testing.T) {
+	cases := []struct {
+		dialect  Dialect
+		timeout  time.Duration
+		expected string
+	}{
+		{Postgres, 5 * time.Second, "SET LOCAL statement_timeout = 5000"},
+		{Postgres, 1500 * time.Millisecond, "SET LOCAL statement_timeout = 1500"},
+		{Postgres, time.Microsecond, "SET LOCAL statement_timeout = 1"},
+		{Postgres, 0, ""},
+		{MySQL, 5 * time.Second, ""},
+		{SQLite, 5 * time.Second, ""},
+		{MSSQL, 5 * time.Second, ""},
+	}
+
+	for _, c := range cases {
+		query := statementTimeoutQuery(c.dialect, c.timeout)
+		if query != c.expected {
+			t.Errorf("unexpected query for %s and %s:\n\t(GOT): %q\n\t(WNT): %q", c.dialect, c.timeout, query, c.expected)
+		}
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	mockCaller("/0001_foo.go")
+	Register(
+		newMigrationFunc(1, migrationUp, nil),
+		newMigrationFunc(1, migrationDown, nil),
+		WithStatementTimeout(time.Second),
+	)
+
+	if migrations[0].statementTimeout != time.Second {
+		t.Errorf("unexpected statement timeout:\n\t(GOT): %s\n\t(WNT): %s", migrations[0].statementTimeout, time.Second)
+	}
+
+	// the timeout is not supported by sqlite, so the migration runs as usual
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1}, migrationUp, db)
+}
+
+func TestNoTransaction(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	migrations[1].noTx = true
+	migrations[2].up = newMigrationFunc(3, migrationUp, errors.New("boom"))
+
+	if _, _, err := Up(db, true); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	// 1 and 2 were committed before 3 started its own transaction
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+}
+
+func TestNoTransaction_Down(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	migrations[1].noTx = true
+
+	if _, _, err := ToVersion(db, true, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{3, 2, 1}, migrationDown, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 0 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 0)
+	}
+}
+
+func TestRequireTx(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(4)
+	migrations[1].noTx = true
+	migrations[3].noTx = true
+	SetRequireTx(true)
+
+	_, _, err := Up(db, true)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if !strings.Contains(err.Error(), "migrations 2, 4") {
+		t.Errorf("expecting versions 2 and 4 in error: %s", err)
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+}
@@ -0,0 +1,81 @@
+package mig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlannedMigration is a migration that would be run to get the database from
+// one version to another.
+type PlannedMigration struct {
+	// Version of the migration.
+	Version int64
+	// Name of the migration, which is the name of its file without the
+	// version and the extension.
+	Name string
+	// Direction is either "up" or "down".
+	Direction string
+}
+
+// PlanBetween returns the migrations, in order, that would be run to go from
+// the version from to the version to, without touching the database. Both
+// versions must be 0 or the version of a registered migration.
+func PlanBetween(from, to int64) ([]PlannedMigration, error) {
+	for _, v := range []int64{from, to} {
+		if !isKnownVersion(v) {
+			return nil, fmt.Errorf("unable to find a migration with version %d", v)
+		}
+	}
+
+	var plan []PlannedMigration
+	sorted := sortedMigrations()
+	if compareVersions(to, from) >= 0 {
+		for _, m := range sorted {
+			if compareVersions(m.version, from) > 0 && compareVersions(m.version, to) <= 0 {
+				plan = append(plan, PlannedMigration{m.version, migrationName(m.file), "up"})
+			}
+		}
+	} else {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			m := sorted[i]
+			if compareVersions(m.version, from) <= 0 && compareVersions(m.version, to) > 0 {
+				plan = append(plan, PlannedMigration{m.version, migrationName(m.file), "down"})
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+func isKnownVersion(v int64) bool {
+	if v == 0 {
+		return true
+	}
+
+	for _, m := range migrations {
+		if m.version == v {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationName returns the name of a migration given its file name, e.g.
+// "create_users" for "0001_create_users.up.sql".
+func migrationName(file string) string {
+	name := baseName(file)
+	for _, ext := range []string{".up.sql", ".down.sql", ".go"} {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+
+	if idx := strings.IndexRune(name, '_'); idx >= 0 {
+		if _, ok := versionPrefix(name); ok {
+			name = name[idx+1:]
+		}
+	}
+
+	return name
+}
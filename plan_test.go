@@ -0,0 +1,48 @@
+package mig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanBetween(t *testing.T) {
+	defer reset()
+	migrations = []migration{
+		{version: 1, up: emptyMigrationFunc, down: emptyMigrationFunc, file: "0001_create_users.go"},
+		{version: 2, up: emptyMigrationFunc, down: emptyMigrationFunc, file: "0002_add_email.up.sql"},
+		{version: 3, up: emptyMigrationFunc, down: emptyMigrationFunc, file: "/migrations/0003_drop_foo.go"},
+	}
+
+	testCases := []struct {
+		name     string
+		from, to int64
+		expected []PlannedMigration
+	}{
+		{"up", 0, 2, []PlannedMigration{
+			{1, "create_users", "up"},
+			{2, "add_email", "up"},
+		}},
+		{"down", 3, 1, []PlannedMigration{
+			{3, "drop_foo", "down"},
+			{2, "add_email", "down"},
+		}},
+		{"no-op", 2, 2, nil},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanBetween(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(plan, tt.expected) {
+				t.Errorf("unexpected plan:\n\t(GOT): %v\n\t(WNT): %v", plan, tt.expected)
+			}
+		})
+	}
+
+	if _, err := PlanBetween(0, 5); err == nil {
+		t.Errorf("expecting error with unknown version")
+	}
+}
@@ -0,0 +1,50 @@
+//go:build migplugin && linux && cgo
+
+package mig
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// pluginRegisterSymbol is the name of the function plugins must export.
+const pluginRegisterSymbol = "RegisterMigrations"
+
+// LoadPlugin opens the Go plugin (.so) in the given path and registers its
+// migrations, so they can be shipped without rebuilding the binary running
+// them. It is only available on Linux with cgo enabled, and only when built
+// with the migplugin build tag, so binaries that don't load plugins don't pay
+// for the plugin package.
+//
+// The plugin must be a main package built with -buildmode=plugin using the
+// same Go version and the same version of this package as the binary loading
+// it, and export a function with the following signature:
+//
+//	func RegisterMigrations() error
+//
+// That function is called once the plugin is opened and must register the
+// migrations calling Register and the rest of registration functions as
+// usual, so the files of the plugin must be named after the version of their
+// migrations too. A plugin can only be loaded once per process.
+func LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open plugin %s: %s", path, err)
+	}
+
+	sym, err := p.Lookup(pluginRegisterSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s does not export %s: %s", path, pluginRegisterSymbol, err)
+	}
+
+	register, ok := sym.(func() error)
+	if !ok {
+		return fmt.Errorf("%s of plugin %s must be a func() error, it is %T", pluginRegisterSymbol, path, sym)
+	}
+
+	if err := register(); err != nil {
+		return fmt.Errorf("unable to register migrations of plugin %s: %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build migplugin && linux && cgo
+
+package mig
+
+import "testing"
+
+func TestLoadPlugin_NotFound(t *testing.T) {
+	if err := LoadPlugin("/does/not/exist.so"); err == nil {
+		t.Errorf("expecting error")
+	}
+}
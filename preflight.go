@@ -0,0 +1,54 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var preflight func(db *sql.DB) error
+
+var errPreflightNeedsSQLDB = errors.New("preflight check needs a *sql.DB and can not run with a custom Querier")
+
+// SetPreflight sets a function that is run once before running any migration,
+// e.g. to make sure a backup exists or the number of rows of a table is in an
+// expected range before a destructive change. If it returns an error, nothing
+// is run and the error is returned wrapped in a PreflightError. It is not run
+// when there are no migrations to run.
+func SetPreflight(fn func(db *sql.DB) error) {
+	preflight = fn
+}
+
+// PreflightError is the error returned when the function set with
+// SetPreflight fails.
+type PreflightError struct {
+	// Err is the error returned by the preflight function.
+	Err error
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("preflight check failed: %s", e.Err)
+}
+
+// Unwrap returns the error returned by the preflight function.
+func (e *PreflightError) Unwrap() error {
+	return e.Err
+}
+
+// runPreflight runs the preflight function, if any. The function needs a
+// *sql.DB, so it fails if the given Querier is not one.
+func runPreflight(q Querier) error {
+	if preflight == nil {
+		return nil
+	}
+
+	db, ok := sqlDBOf(q)
+	if !ok {
+		return &PreflightError{errPreflightNeedsSQLDB}
+	}
+
+	if err := preflight(db); err != nil {
+		return &PreflightError{err}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestSetPreflight(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(2)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	errNoBackup := errors.New("no backup")
+	var calls int
+	SetPreflight(func(*sql.DB) error {
+		calls++
+		return errNoBackup
+	})
+
+	_, _, err := Up(db, true)
+	perr, ok := err.(*PreflightError)
+	if !ok {
+		t.Fatalf("expecting preflight error, got: %v", err)
+	}
+
+	if !errors.Is(perr, errNoBackup) {
+		t.Errorf("unexpected preflight error: %s", perr)
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+
+	SetPreflight(func(*sql.DB) error {
+		calls++
+		return nil
+	})
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	// there is nothing to run, so the preflight is not run either
+	if _, _, err := Up(db, true); err != ErrNoPendingMigrations {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("unexpected number of preflight calls:\n\t(GOT): %d\n\t(WNT): %d", calls, 2)
+	}
+}
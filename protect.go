@@ -0,0 +1,81 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+var protectVersionTable bool
+
+// SetProtectVersionTable sets whether the statements run by migrations that
+// target the version table, or the tables named after it, such as the
+// migration log, must be rejected so they can't corrupt the state kept by mig.
+// Statements run with Exec and Query fail, while the ones run with QueryRow,
+// which can't report an error, are recorded as a warning. Migrations
+// registered with RegisterDB or RegisterTxFunc are not protected.
+//
+// Detection is a case-insensitive search of the table name in the query, so
+// statements that only mention it, e.g. in a string literal, are rejected as
+// well.
+func SetProtectVersionTable(protect bool) {
+	protectVersionTable = protect
+}
+
+// protectedDB is a DB that rejects the statements targeting the version table.
+type protectedDB struct {
+	DB
+}
+
+// protect returns the given database wrapped in a protectedDB if the version
+// table must be protected.
+func protect(db DB) DB {
+	if !protectVersionTable {
+		return db
+	}
+	return protectedDB{db}
+}
+
+// unprotect returns the database wrapped by the given one if it's a
+// protectedDB.
+func unprotect(db DB) DB {
+	if p, ok := db.(protectedDB); ok {
+		return p.DB
+	}
+	return db
+}
+
+func (p protectedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if err := checkVersionTable(query); err != nil {
+		return nil, err
+	}
+	return p.DB.Exec(query, args...)
+}
+
+func (p protectedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if err := checkVersionTable(query); err != nil {
+		return nil, err
+	}
+	return p.DB.Query(query, args...)
+}
+
+func (p protectedDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if err := checkVersionTable(query); err != nil {
+		warnings.add(err.Error())
+	}
+	return p.DB.QueryRow(query, args...)
+}
+
+// checkVersionTable returns an error if the given query targets the version
+// table.
+func checkVersionTable(query string) error {
+	name := tableName
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	if strings.Contains(strings.ToLower(query), strings.ToLower(name)) {
+		return fmt.Errorf("statement targets the version table %s, which can only be modified by mig: %s", tableName, query)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package mig
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetProtectVersionTable(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(2)
+	migrations[1].up = func(db DB) error {
+		_, err := db.Exec("INSERT INTO __VERSION (version) VALUES (100)")
+		return err
+	}
+	SetProtectVersionTable(true)
+
+	_, _, err := UpMode(db, TxBatch)
+	if err == nil || !strings.Contains(err.Error(), "version table") {
+		t.Fatalf("expecting version table error, got: %v", err)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 0 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 0)
+	}
+
+	migrations[1].up = func(db DB) error {
+		var n int
+		return db.QueryRow("SELECT COUNT(*) FROM __version").Scan(&n)
+	}
+
+	if _, _, err := UpMode(db, TxBatch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1}, migrationUp, db)
+
+	if v, err := CurrentVersion(db); err != nil || v != 2 {
+		t.Errorf("unexpected version: %d, err: %v", v, err)
+	}
+
+	if ws := Warnings(); len(ws) != 1 || ws[0].Version != 2 {
+		t.Errorf("unexpected warnings: %v", ws)
+	}
+}
+
+func TestCheckVersionTable(t *testing.T) {
+	defer SetTableName(tableName)
+
+	testCases := []struct {
+		table string
+		query string
+		err   bool
+	}{
+		{"__version", "INSERT INTO __version VALUES (1)", true},
+		{"__version", "delete from __VERSION_log", true},
+		{"__version", "UPDATE foo SET bar = 1", false},
+		{"public.__version", `UPDATE "__version" SET version = 2`, true},
+	}
+
+	for _, tt := range testCases {
+		SetTableName(tt.table)
+		err := checkVersionTable(tt.query)
+		if tt.err != (err != nil) {
+			t.Errorf("%s: unexpected error: %v", tt.query, err)
+		}
+	}
+}
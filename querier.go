@@ -0,0 +1,82 @@
+package mig
+
+import "database/sql"
+
+// Tx is a transaction started by a Querier.
+type Tx interface {
+	DB
+	Commit() error
+	Rollback() error
+}
+
+// Querier is a database that can start transactions, so migrations can be
+// run against backends that implement DB but are not a *sql.DB, such as a
+// SQL gateway accessed through RPC. The dialect of a Querier can not be
+// detected, so it must be set with SetDialect.
+type Querier interface {
+	DB
+	Begin() (Tx, error)
+}
+
+// sqlQuerier is a *sql.DB that satisfies Querier.
+type sqlQuerier struct {
+	*sql.DB
+}
+
+func (q sqlQuerier) Begin() (Tx, error) {
+	return q.DB.Begin()
+}
+
+// querierOf returns the given database as a Querier.
+func querierOf(db *sql.DB) Querier {
+	return sqlQuerier{db}
+}
+
+// sqlDBOf returns the *sql.DB behind the given Querier, if there is one.
+func sqlDBOf(q Querier) (*sql.DB, bool) {
+	if q, ok := q.(sqlQuerier); ok {
+		return q.DB, true
+	}
+	return nil, false
+}
+
+// withQuerier runs fn using the database set with SetDatabase. Unlike with a
+// *sql.DB, the statement to switch databases is run directly on the Querier,
+// so it must always use the same connection for it to have any effect.
+func withQuerier(q Querier, fn func(DB) error) error {
+	if db, ok := sqlDBOf(q); ok {
+		return withDatabase(db, fn)
+	}
+
+	if err := useDatabase(q, dialectFor(q)); err != nil {
+		return err
+	}
+	return fn(q)
+}
+
+// UpWith runs all the pending database migrations until it's up to date
+// using the given Querier instead of a *sql.DB. Other than that, it works
+// exactly like UpMode.
+func UpWith(q Querier, mode TxMode) (oldVersion, newVersion int64, err error) {
+	return up(q, mode)
+}
+
+// DownWith rolls back a single database migration using the given Querier
+// instead of a *sql.DB. Other than that, it works exactly like Down.
+func DownWith(q Querier, tx bool) (oldVersion, newVersion int64, err error) {
+	return down(q, tx)
+}
+
+// ToVersionWith executes up or down migrations from the current version until
+// the target version using the given Querier instead of a *sql.DB. Other than
+// that, it works exactly like ToVersionMode.
+func ToVersionWith(q Querier, mode TxMode, v int64) (oldVersion, newVersion int64, err error) {
+	return toVersion(q, mode, v)
+}
+
+// CurrentVersionWith returns the current version of the database using the
+// given Querier instead of a *sql.DB, creating the version table if needed.
+// The reader set with SetReaderDB is ignored.
+func CurrentVersionWith(q Querier) (int64, error) {
+	return currentVersion(q)
+}
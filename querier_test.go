@@ -0,0 +1,93 @@
+package mig
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// testQuerier is a Querier that is not a *sql.DB.
+type testQuerier struct {
+	db    *sql.DB
+	begun int
+}
+
+func (q *testQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.db.Exec(query, args...)
+}
+
+func (q *testQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.db.Query(query, args...)
+}
+
+func (q *testQuerier) QueryRow(query string, args ...interface{}) *sql.Row {
+	return q.db.QueryRow(query, args...)
+}
+
+func (q *testQuerier) Begin() (Tx, error) {
+	q.begun++
+	return q.db.Begin()
+}
+
+func TestQuerier(t *testing.T) {
+	defer reset()
+	defer SetDialect("")
+	SetDialect(SQLite)
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	q := &testQuerier{db: db}
+	oldVersion, newVersion, err := UpWith(q, TxBatch)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 0 || newVersion != 3 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): 0, 3", oldVersion, newVersion)
+	}
+
+	if q.begun != 1 {
+		t.Errorf("unexpected number of transactions:\n\t(GOT): %d\n\t(WNT): %d", q.begun, 1)
+	}
+
+	assertMigration(t, []int64{1, 2, 3}, migrationUp, db)
+
+	if _, _, err := DownWith(q, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := ToVersionWith(q, TxPerMigration, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{3, 2, 1}, migrationDown, db)
+
+	v, err := CurrentVersionWith(q)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 0 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 0)
+	}
+
+	if q.begun != 3 {
+		t.Errorf("unexpected number of transactions:\n\t(GOT): %d\n\t(WNT): %d", q.begun, 3)
+	}
+}
+
+func TestQuerier_Preflight(t *testing.T) {
+	defer reset()
+	defer SetDialect("")
+	SetDialect(SQLite)
+	migrations = generateMigrations(1)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	SetPreflight(func(*sql.DB) error { return nil })
+
+	_, _, err := UpWith(&testQuerier{db: db}, TxBatch)
+	if _, ok := err.(*PreflightError); !ok {
+		t.Errorf("expecting a preflight error, got %v", err)
+	}
+}
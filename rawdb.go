@@ -0,0 +1,144 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errNeedsSQLDB is returned by migrations registered with RegisterDB when they
+// are run inside a transaction.
+var errNeedsSQLDB = errors.New("migration needs a *sql.DB and can not run inside a transaction")
+
+// errNeedsSQLTx is returned by migrations registered with RegisterTxFunc when
+// they are not run inside a *sql.Tx.
+var errNeedsSQLTx = errors.New("migration needs a *sql.Tx and can only run inside a transaction")
+
+// RegisterDB adds a new migration whose functions receive the *sql.DB instead
+// of the DB interface, for operations that need the concrete type, such as
+// getting a single connection with Conn. These migrations always run outside
+// of a transaction, as if they were registered with NoTransaction. As with
+// Register, it must be called from a migration file.
+//
+// If a database was set with SetDatabase, keep in mind that it's only selected
+// in the connections used by mig, not in the ones the migration gets from the
+// pool.
+func RegisterDB(up, down func(*sql.DB) error, opts ...Option) {
+	if up == nil || down == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version: v,
+		up:      sqlDBMigrationFunc(up),
+		down:    sqlDBMigrationFunc(down),
+		file:    file,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	m.noTx = true
+	m.needsDB = true
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// sqlDBMigrationFunc returns a MigrationFunc that calls fn with the *sql.DB
+// behind the DB it's given.
+func sqlDBMigrationFunc(fn func(*sql.DB) error) MigrationFunc {
+	return func(db DB) error {
+		switch db := unprotect(db).(type) {
+		case *sql.DB:
+			return fn(db)
+		case connDB:
+			return fn(db.db)
+		default:
+			return errNeedsSQLDB
+		}
+	}
+}
+
+// RegisterTxFunc adds a new migration whose functions receive the *sql.Tx of
+// the transaction they run in instead of the DB interface, for operations that
+// need the concrete type, such as preparing statements with Stmt. These
+// migrations can only run inside a transaction, so running them with
+// transactions disabled fails before running any migration. The NoTransaction
+// option is ignored for them. As with Register, it must be called from a
+// migration file.
+//
+// Transactions are only *sql.Tx when migrations are run with a *sql.DB, so
+// these migrations fail with a custom Querier.
+func RegisterTxFunc(up, down func(*sql.Tx) error, opts ...Option) {
+	if up == nil || down == nil {
+		panic(fmt.Errorf("migrations cannot be nil in register"))
+	}
+
+	file := baseName(caller())
+	v, err := versionFromFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	m := migration{
+		version: v,
+		up:      sqlTxMigrationFunc(up),
+		down:    sqlTxMigrationFunc(down),
+		file:    file,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	m.noTx = false
+	m.needsTx = true
+
+	if err := addMigration(m); err != nil {
+		panic(err)
+	}
+}
+
+// sqlTxMigrationFunc returns a MigrationFunc that calls fn with the *sql.Tx
+// it's given.
+func sqlTxMigrationFunc(fn func(*sql.Tx) error) MigrationFunc {
+	return func(db DB) error {
+		tx, ok := unprotect(db).(*sql.Tx)
+		if !ok {
+			return errNeedsSQLTx
+		}
+		return fn(tx)
+	}
+}
+
+// checkNeedsTx returns an error listing the given migrations that need a
+// transaction if they would be run with the given mode, which does not use
+// any.
+func checkNeedsTx(migrations []migration, mode TxMode) error {
+	if mode != TxNone {
+		return nil
+	}
+
+	var versions []string
+	for _, m := range migrations {
+		if m.needsTx {
+			versions = append(versions, strconv.FormatInt(m.version, 10))
+		}
+	}
+
+	if len(versions) > 0 {
+		return fmt.Errorf(
+			"migrations %s can only run inside a transaction, but transactions are disabled",
+			strings.Join(versions, ", "),
+		)
+	}
+
+	return nil
+}
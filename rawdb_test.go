@@ -0,0 +1,123 @@
+package mig
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestRegisterDB(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	mockCaller("/0001_foo.go")
+	Register(newMigrationFunc(1, migrationUp, nil), newMigrationFunc(1, migrationDown, nil))
+
+	mockCaller("/0002_foo.go")
+	RegisterDB(
+		func(db *sql.DB) error {
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			_, err = conn.ExecContext(context.Background(), fmt.Sprintf("INSERT INTO migrations_run (version, migration_type) VALUES (2, %d)", migrationUp))
+			return err
+		},
+		func(db *sql.DB) error {
+			return newMigrationFunc(2, migrationDown, nil)(db)
+		},
+	)
+
+	if !migrations[1].noTx {
+		t.Errorf("expecting migration to run outside of a transaction")
+	}
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{2}, migrationDown, db)
+}
+
+func TestRegisterDB_InsideTransaction(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer tx.Rollback()
+
+	fn := sqlDBMigrationFunc(func(*sql.DB) error { return nil })
+	if err := fn(tx); err != errNeedsSQLDB {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, errNeedsSQLDB)
+	}
+}
+
+func TestRegisterTxFunc(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	mockCaller("/0001_foo.go")
+	RegisterTxFunc(
+		func(tx *sql.Tx) error {
+			stmt, err := tx.Prepare("INSERT INTO migrations_run (version, migration_type) VALUES (?, ?)")
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+
+			_, err = stmt.Exec(1, migrationUp)
+			return err
+		},
+		func(tx *sql.Tx) error {
+			return newMigrationFunc(1, migrationDown, nil)(tx)
+		},
+		NoTransaction(),
+	)
+
+	if migrations[0].noTx || !migrations[0].needsTx {
+		t.Errorf("expecting migration to run only inside a transaction")
+	}
+
+	if _, _, err := UpMode(db, TxNone); err == nil {
+		t.Fatalf("expecting error without transactions")
+	}
+	assertMigration(t, nil, migrationUp, db)
+
+	if _, _, err := UpMode(db, TxPerMigration); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1}, migrationUp, db)
+
+	if _, _, err := Down(db, false); err == nil {
+		t.Fatalf("expecting error without transactions")
+	}
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1}, migrationDown, db)
+}
+
+func TestRegisterTxFunc_OutsideTransaction(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	fn := sqlTxMigrationFunc(func(*sql.Tx) error { return nil })
+	if err := fn(db); err != errNeedsSQLTx {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, errNeedsSQLTx)
+	}
+}
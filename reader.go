@@ -0,0 +1,19 @@
+package mig
+
+import "database/sql"
+
+var readerDB *sql.DB
+
+// SetReaderDB sets a database, such as a read replica, from which the current
+// version is read by CurrentVersion, CurrentVersionInfo and Counts, so health
+// checks and status probes don't hit the primary database. Running migrations
+// always reads and writes the version using the database they are given, and
+// so does CurrentVersion if the version table does not exist in the reader
+// yet. A nil database, which is the default, disables it.
+//
+// Keep in mind that replicas might lag behind the primary database, so right
+// after running migrations the version read from the reader might still be
+// the old one.
+func SetReaderDB(db *sql.DB) {
+	readerDB = db
+}
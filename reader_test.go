@@ -0,0 +1,62 @@
+package mig
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSetReaderDB(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(3)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	reader, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer reader.Close()
+	reader.SetMaxOpenConns(1)
+
+	SetReaderDB(reader)
+	defer SetReaderDB(nil)
+
+	// the table does not exist in the reader yet
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+
+	if err := setup(reader); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SetVersion(reader, 3); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, err = CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 3 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 3)
+	}
+
+	// migrations are run using the version of the primary database
+	oldVersion, newVersion, err := Up(db, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if oldVersion != 1 || newVersion != 3 {
+		t.Errorf("unexpected versions:\n\t(GOT): %d, %d\n\t(WNT): %d, %d", oldVersion, newVersion, 1, 3)
+	}
+
+	assertMigration(t, []int64{2, 3}, migrationUp, db)
+}
@@ -0,0 +1,244 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CheckReversible checks that the down of every registered migration reverses
+// its up. Starting from an empty database, it applies the up of every
+// migration in order followed by its down, and reports the migrations whose
+// down left tables behind or removed tables that were there before, comparing
+// the tables in the database before and after each of them. Then the up is
+// applied again to continue with the next migration.
+//
+// Everything is run inside a transaction that is always rolled back, so it
+// should be run against a throwaway database, such as an in-memory SQLite
+// database, or against databases with transactional DDL, such as PostgreSQL.
+// The check does not stop at the first migration that fails it, all the
+// problems found are returned joined in a single error. Each migration is
+// checked inside a savepoint, so when one of its steps fails, the changes of
+// that step are rolled back before checking the next migration. MySQL commits
+// DDL statements implicitly, so savepoints are not used with it and a failed
+// step leaves its changes behind. Irreversible migrations are not checked,
+// and neither are migrations registered with RegisterDB, since they can't run
+// inside a transaction. A warning is logged for each one of the latter.
+func CheckReversible(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %s", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	d := dialectOf(db)
+	if err := useDatabase(tx, d); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range sortedMigrations() {
+		if m.needsDB {
+			logger.Warnf("migration %d not checked: needs *sql.DB", m.version)
+			continue
+		}
+
+		err := checkReversible(tx, d, m)
+		var stepErr checkStepError
+		if errors.As(err, &stepErr) {
+			errs = append(errs, stepErr.err)
+		} else if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkStepError is a problem found checking a migration, as opposed to an
+// error that prevents checking the rest of migrations.
+type checkStepError struct {
+	err error
+}
+
+func (e checkStepError) Error() string {
+	return e.err.Error()
+}
+
+// checkReversible checks that the down of the given migration reverses its
+// up, leaving the database as it is after applying the up. Problems found
+// with the migration are returned as a checkStepError after rolling back the
+// step that failed.
+func checkReversible(tx DB, d Dialect, m migration) error {
+	before, err := listTables(tx, d)
+	if err != nil {
+		return err
+	}
+
+	if err := savepoint(tx, d, "mig_before_up"); err != nil {
+		return err
+	}
+	defer func() {
+		_ = releaseSavepoint(tx, d, "mig_before_up")
+	}()
+
+	if err := m.up(tx); err != nil {
+		return failStep(tx, d, "mig_before_up", fmt.Errorf("migration %d: error applying up: %s", m.version, err))
+	}
+
+	if m.down == nil {
+		return nil
+	}
+
+	if err := savepoint(tx, d, "mig_after_up"); err != nil {
+		return err
+	}
+
+	if err := m.down(tx); err != nil {
+		return failStep(tx, d, "mig_after_up", fmt.Errorf("migration %d: error applying down: %s", m.version, err))
+	}
+
+	after, err := listTables(tx, d)
+	if err != nil {
+		return err
+	}
+
+	problem := compareTables(m.version, before, after)
+
+	if err := m.up(tx); err != nil {
+		err = fmt.Errorf("migration %d: error applying up again after down: %s", m.version, err)
+		return failStep(tx, d, "mig_after_up", errors.Join(problem, err))
+	}
+
+	if err := releaseSavepoint(tx, d, "mig_after_up"); err != nil {
+		return err
+	}
+
+	if problem != nil {
+		return checkStepError{problem}
+	}
+	return nil
+}
+
+// failStep rolls back to the given savepoint and returns the given problem
+// as a checkStepError, or the error rolling back if it fails.
+func failStep(tx DB, d Dialect, name string, problem error) error {
+	if err := rollbackToSavepoint(tx, d, name); err != nil {
+		return errors.Join(problem, err)
+	}
+	return checkStepError{problem}
+}
+
+func savepoint(tx DB, d Dialect, name string) error {
+	var query string
+	switch d {
+	case MySQL:
+		return nil
+	case MSSQL:
+		query = "SAVE TRANSACTION " + name
+	default:
+		query = "SAVEPOINT " + name
+	}
+
+	if _, err := tx.Exec(query, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to create savepoint %s: %s", name, err)
+	}
+	return nil
+}
+
+func rollbackToSavepoint(tx DB, d Dialect, name string) error {
+	var query string
+	switch d {
+	case MySQL:
+		return nil
+	case MSSQL:
+		query = "ROLLBACK TRANSACTION " + name
+	default:
+		query = "ROLLBACK TO SAVEPOINT " + name
+	}
+
+	if _, err := tx.Exec(query, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to roll back to savepoint %s: %s", name, err)
+	}
+	return nil
+}
+
+func releaseSavepoint(tx DB, d Dialect, name string) error {
+	// savepoints can't be released in SQL Server, they are discarded along
+	// with the transaction
+	if d == MySQL || d == MSSQL {
+		return nil
+	}
+
+	if _, err := tx.Exec("RELEASE SAVEPOINT "+name, execModeArgs()...); err != nil {
+		return fmt.Errorf("unable to release savepoint %s: %s", name, err)
+	}
+	return nil
+}
+
+// listTables returns the names of the tables in the database, except for
+// the ones used by mig itself.
+func listTables(db DB, d Dialect) (map[string]bool, error) {
+	rows, err := db.Query(listTablesQuery(d), execModeArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tables: %s", err)
+	}
+	defer rows.Close()
+
+	var tables = make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("unable to scan table name: %s", err)
+		}
+
+		if name != tableName && !strings.HasPrefix(name, tableName+"_") {
+			tables[name] = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list tables: %s", err)
+	}
+
+	return tables, nil
+}
+
+// compareTables returns an error describing the differences between the
+// tables before applying the given migration and after rolling it back.
+func compareTables(version int64, before, after map[string]bool) error {
+	var leftover, removed []string
+	for t := range after {
+		if !before[t] {
+			leftover = append(leftover, t)
+		}
+	}
+
+	for t := range before {
+		if !after[t] {
+			removed = append(removed, t)
+		}
+	}
+
+	if len(leftover) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	sort.Strings(leftover)
+	sort.Strings(removed)
+
+	var problems []string
+	if len(leftover) > 0 {
+		problems = append(problems, fmt.Sprintf("left tables %s behind", strings.Join(leftover, ", ")))
+	}
+
+	if len(removed) > 0 {
+		problems = append(problems, fmt.Sprintf("removed tables %s", strings.Join(removed, ", ")))
+	}
+
+	return fmt.Errorf("migration %d: down does not reverse up, it %s", version, strings.Join(problems, " and "))
+}
@@ -0,0 +1,239 @@
+package mig
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestCheckReversible(t *testing.T) {
+	defer reset()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	exec := func(query string) MigrationFunc {
+		return func(db DB) error {
+			_, err := db.Exec(query)
+			return err
+		}
+	}
+
+	migrations = []migration{
+		{
+			version: 1,
+			up:      exec("CREATE TABLE users (id integer)"),
+			down:    exec("DROP TABLE users"),
+		},
+		{
+			version: 2,
+			up:      exec("CREATE TABLE posts (id integer)"),
+			down:    exec("SELECT 1"),
+		},
+		{
+			version: 3,
+			up:      exec("CREATE TABLE IF NOT EXISTS comments (id integer)"),
+			down:    exec("DROP TABLE users"),
+		},
+		{
+			version: 4,
+			up:      exec("CREATE TABLE tags (id integer)"),
+		},
+	}
+
+	err = CheckReversible(db)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	// migration 2 fails when it's applied again, but the check goes on with
+	// the database as it was after applying it the first time
+	msg := err.Error()
+	for _, expected := range []string{
+		"migration 2: down does not reverse up, it left tables posts behind",
+		"migration 2: error applying up again after down",
+		"migration 3: down does not reverse up, it left tables comments behind and removed tables users",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expecting %q in error: %s", expected, msg)
+		}
+	}
+
+	if strings.Contains(msg, "migration 1") {
+		t.Errorf("not expecting migration 1 in error: %s", msg)
+	}
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ok {
+		t.Errorf("expecting changes to be rolled back")
+	}
+}
+
+func TestCheckReversible_Aggregated(t *testing.T) {
+	defer reset()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	exec := func(query string) MigrationFunc {
+		return func(db DB) error {
+			_, err := db.Exec(query)
+			return err
+		}
+	}
+
+	migrations = []migration{
+		{
+			version: 1,
+			up:      exec("CREATE TABLE users (id integer)"),
+			down:    exec("DROP TABLE users"),
+		},
+		{
+			version: 2,
+			up:      exec("CREATE TABLE IF NOT EXISTS posts (id integer)"),
+			down:    exec("SELECT 1"),
+		},
+		{
+			version: 3,
+			up:      exec("CREATE TABLE IF NOT EXISTS comments (id integer)"),
+			down:    exec("DROP TABLE users"),
+		},
+	}
+
+	err = CheckReversible(db)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{
+		"migration 2: down does not reverse up, it left tables posts behind",
+		"migration 3: down does not reverse up, it left tables comments behind and removed tables users",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expecting %q in error: %s", expected, msg)
+		}
+	}
+}
+
+func TestCheckReversible_FailedSteps(t *testing.T) {
+	defer reset()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	exec := func(queries ...string) MigrationFunc {
+		return func(db DB) error {
+			for _, q := range queries {
+				if _, err := db.Exec(q); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	migrations = []migration{
+		{
+			version: 1,
+			up:      exec("CREATE TABLE users (id integer)", "CREATE TABLE broken ("),
+			down:    exec("DROP TABLE users"),
+		},
+		{
+			version: 2,
+			up:      exec("CREATE TABLE posts (id integer)"),
+			down:    exec("DROP TABLE posts", "DROP TABLE missing"),
+		},
+		{
+			// passes only if the changes of the failed up of migration 1
+			// were rolled back and migration 2 was left applied
+			version: 3,
+			up:      exec("CREATE TABLE users (id integer)", "INSERT INTO posts VALUES (1)"),
+			down:    exec("DELETE FROM posts", "DROP TABLE users"),
+		},
+	}
+
+	err = CheckReversible(db)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{
+		"migration 1: error applying up",
+		"migration 2: error applying down",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expecting %q in error: %s", expected, msg)
+		}
+	}
+
+	if strings.Contains(msg, "migration 3") {
+		t.Errorf("not expecting migration 3 in error: %s", msg)
+	}
+}
+
+func TestCheckReversible_NeedsDB(t *testing.T) {
+	defer reset()
+	defer SetLogger(nil)
+
+	var log recordingLogger
+	SetLogger(&log)
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	exec := func(query string) MigrationFunc {
+		return func(db DB) error {
+			_, err := db.Exec(query)
+			return err
+		}
+	}
+
+	migrations = []migration{
+		{
+			version: 1,
+			up:      sqlDBMigrationFunc(func(*sql.DB) error { return nil }),
+			down:    sqlDBMigrationFunc(func(*sql.DB) error { return nil }),
+			noTx:    true,
+			needsDB: true,
+		},
+		{
+			version: 2,
+			up:      exec("CREATE TABLE posts (id integer)"),
+			down:    exec("SELECT 1"),
+		},
+	}
+
+	err = CheckReversible(db)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	msg := err.Error()
+	if strings.Contains(msg, "migration 1") {
+		t.Errorf("not expecting migration 1 in error: %s", msg)
+	}
+
+	if !strings.Contains(msg, "migration 2: down does not reverse up") {
+		t.Errorf("expecting migration 2 in error: %s", msg)
+	}
+
+	expected := "migration 1 not checked: needs *sql.DB"
+	if msgs := log.messages(); len(msgs) != 1 || msgs[0] != expected {
+		t.Errorf("unexpected messages:\n\t(GOT): %v\n\t(WNT): %v", msgs, []string{expected})
+	}
+}
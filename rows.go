@@ -0,0 +1,43 @@
+package mig
+
+import (
+	"database/sql"
+	"sync/atomic"
+)
+
+var rowsAffected int64
+
+// RowsAffected returns the total number of rows affected by the statements
+// run by the migrations during the last run. The statements of migrations
+// loaded from SQL files are always counted, but Go migrations only count the
+// ones they execute through a CountingDB. Statements whose driver can not
+// tell the rows they affected are not counted.
+func RowsAffected() int64 {
+	return atomic.LoadInt64(&rowsAffected)
+}
+
+// CountingDB is a DB that adds the rows affected by the statements executed
+// with it to the count returned by RowsAffected. Go migrations can wrap the
+// DB they are given with it to report the rows they change:
+//
+//	db = mig.CountingDB{DB: db}
+type CountingDB struct {
+	DB
+}
+
+// Exec executes the given query and counts the rows it affected.
+func (c CountingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := c.DB.Exec(query, args...)
+	if err != nil {
+		return res, err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		atomic.AddInt64(&rowsAffected, n)
+	}
+	return res, nil
+}
+
+func resetRowsAffected() {
+	atomic.StoreInt64(&rowsAffected, 0)
+}
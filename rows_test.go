@@ -0,0 +1,53 @@
+package mig
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestRowsAffected(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql": {Data: []byte(`
+			CREATE TABLE foo (id int);
+			INSERT INTO foo (id) VALUES (1), (2), (3);
+			UPDATE foo SET id = id + 10 WHERE id > 1;
+		`)},
+		"0001_foo.down.sql": {Data: []byte("DROP TABLE foo;")},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mockCaller("0002_bar.go")
+	Register(func(db DB) error {
+		if _, err := db.Exec(`INSERT INTO foo (id) VALUES (100)`); err != nil {
+			return err
+		}
+
+		_, err := CountingDB{db}.Exec(`DELETE FROM foo WHERE id > 10`)
+		return err
+	}, emptyMigrationFunc)
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// 3 inserted and 2 updated by the SQL migration and 3 deleted by the Go
+	// migration through CountingDB, the insert without it is not counted
+	if n := RowsAffected(); n != 8 {
+		t.Errorf("unexpected rows affected:\n\t(GOT): %d\n\t(WNT): %d", n, 8)
+	}
+
+	if _, _, err := Down(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if n := RowsAffected(); n != 0 {
+		t.Errorf("expecting rows affected to be reset, got: %d", n)
+	}
+}
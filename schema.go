@@ -0,0 +1,35 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNoSchemaDumper is returned by DumpSchema when no dumper has been set.
+var ErrNoSchemaDumper = errors.New("no schema dumper has been set, use SetSchemaDumper")
+
+var schemaDumper func(db *sql.DB) (string, error)
+
+// SetSchemaDumper sets the function used to dump the schema of the database
+// as DDL. Since there is no portable way to do it with database/sql, it must
+// be provided by the user, e.g. running pg_dump --schema-only or querying
+// sqlite_master.
+func SetSchemaDumper(dumper func(db *sql.DB) (string, error)) {
+	schemaDumper = dumper
+}
+
+// DumpSchema returns the schema of the database as DDL using the dumper set
+// with SetSchemaDumper.
+func DumpSchema(db *sql.DB) (string, error) {
+	if schemaDumper == nil {
+		return "", ErrNoSchemaDumper
+	}
+
+	schema, err := schemaDumper(db)
+	if err != nil {
+		return "", fmt.Errorf("unable to dump schema: %s", err)
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,45 @@
+package mig
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestDumpSchema(t *testing.T) {
+	defer SetSchemaDumper(nil)
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, err := DumpSchema(db); err != ErrNoSchemaDumper {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoSchemaDumper)
+	}
+
+	SetSchemaDumper(func(db *sql.DB) (string, error) {
+		rows, err := db.Query("SELECT sql FROM sqlite_master WHERE type = 'table' ORDER BY name")
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+
+		var stmts []string
+		for rows.Next() {
+			var stmt string
+			if err := rows.Scan(&stmt); err != nil {
+				return "", err
+			}
+			stmts = append(stmts, stmt+";")
+		}
+
+		return strings.Join(stmts, "\n"), rows.Err()
+	})
+
+	schema, err := DumpSchema(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.Contains(schema, tableName) || !strings.Contains(schema, "migrations_run") {
+		t.Errorf("unexpected schema: %s", schema)
+	}
+}
@@ -0,0 +1,182 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PrintUp writes to w a SQL script with the statements that running all the
+// pending migrations would execute, including the ones to create and update
+// the version table and the migration log, so it can be reviewed and run
+// manually. Nothing is executed, the database is only read to know its current
+// version. Migrations written in Go can not be printed, so a comment is
+// written for them instead and the script will be incomplete.
+func PrintUp(db *sql.DB, w io.Writer) error {
+	if versionStore != nil {
+		return errExternalStore
+	}
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		return err
+	}
+
+	table, err := versionTable(db)
+	if err != nil {
+		return err
+	}
+
+	events, err := logTable(db)
+	if err != nil {
+		return err
+	}
+
+	var (
+		current int64
+		hasRow  bool
+	)
+	if ok {
+		var logExists int
+		query := tableExistsQuery(dialectFor(db), logTableName())
+		if err := db.QueryRow(query, execModeArgs()...).Scan(&logExists); err != nil {
+			return fmt.Errorf("unable to check if table %s exists: %s", logTableName(), err)
+		}
+
+		if logExists == 0 {
+			return fmt.Errorf("table %s has the old layout without a migration log, run any other command to upgrade it first", tableName)
+		}
+
+		var rows int
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s", table)
+		if err := db.QueryRow(query, execModeArgs()...).Scan(&rows); err != nil {
+			return fmt.Errorf("unable to count rows of table %s: %s", tableName, err)
+		}
+		hasRow = rows > 0
+
+		if current, err = readVersion(db); err != nil {
+			return err
+		}
+	} else {
+		stmt := fmt.Sprintf(migrationsTableSQL, table, versionColumn, updatedAtColumn)
+		if _, err := fmt.Fprintf(w, "%s;\n\n", stmt); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s;\n\n", fmt.Sprintf(logTableSQL, events)); err != nil {
+			return err
+		}
+	}
+
+	updatedAt := time.Now().Unix()
+	prev := current
+	var pending int
+	for _, m := range sortedMigrations() {
+		if compareVersions(m.version, current) <= 0 {
+			continue
+		}
+		pending++
+
+		if err := printMigration(w, m, m.file, m.upSQL); err != nil {
+			return err
+		}
+
+		// updated_at must increase with every version, as in SetVersion
+		stmt := fmt.Sprintf(
+			"UPDATE %s SET %s = %d, %s = %d",
+			table, versionColumn, m.version, updatedAtColumn, updatedAt,
+		)
+		if !hasRow {
+			stmt = fmt.Sprintf(
+				"INSERT INTO %s (%s, %s) VALUES (%d, %d)",
+				table, versionColumn, updatedAtColumn, m.version, updatedAt,
+			)
+			hasRow = true
+		}
+
+		logStmt := appendLogQuery(events, m.version, direction(prev, m.version), outcomeSuccess, updatedAt, runMessage)
+		if _, err := fmt.Fprintf(w, "%s;\n%s;\n\n", stmt, logStmt); err != nil {
+			return err
+		}
+		prev = m.version
+		updatedAt++
+	}
+
+	if pending == 0 {
+		return ErrNoPendingMigrations
+	}
+
+	return nil
+}
+
+// RollbackScript returns a SQL script with the downs of the migrations with a
+// version between from and to, both included, in the order they would be
+// rolled back, so it can be kept at hand to roll them back manually. Each
+// migration is preceded by a comment with its version. Migrations written in
+// Go and irreversible migrations can't be scripted, so there is only a comment
+// noting it for them. The version table is not updated by the script.
+func RollbackScript(from, to int64) (string, error) {
+	if compareVersions(from, to) > 0 {
+		return "", fmt.Errorf("invalid range to roll back, %d is after %d", from, to)
+	}
+
+	sorted := sortedMigrations()
+	var buf strings.Builder
+	var n int
+	for i := len(sorted) - 1; i >= 0; i-- {
+		m := sorted[i]
+		if compareVersions(m.version, from) < 0 || compareVersions(m.version, to) > 0 {
+			continue
+		}
+		n++
+
+		if n > 1 {
+			buf.WriteString("\n")
+		}
+
+		if m.irreversible {
+			fmt.Fprintf(&buf, "-- migration %d (%s) is irreversible, it can't be rolled back\n", m.version, m.file)
+			continue
+		}
+
+		if err := printMigration(&buf, m, strings.TrimSuffix(m.file, ".up.sql")+".down.sql", m.downSQL); err != nil {
+			return "", err
+		}
+	}
+
+	if n == 0 {
+		return "", ErrNoPendingMigrations
+	}
+
+	return buf.String(), nil
+}
+
+// printMigration writes the given statements of the migration, which are
+// either its up or its down, read from the given file.
+func printMigration(w io.Writer, m migration, file string, stmts []string) error {
+	if !strings.HasSuffix(m.file, ".sql") {
+		_, err := fmt.Fprintf(w, "-- migration %d (%s) is written in Go, its SQL is not statically known\n", m.version, m.file)
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "-- migration %d (%s)\n", m.version, file); err != nil {
+		return err
+	}
+
+	for _, stmt := range stmts {
+		if statementHook != nil {
+			var err error
+			if stmt, err = statementHook(stmt); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "%s;\n", stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
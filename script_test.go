@@ -0,0 +1,160 @@
+package mig
+
+import (
+	"bytes"
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var timestampRegex = regexp.MustCompile(`\d{9,}`)
+
+func TestPrintUp(t *testing.T) {
+	defer reset()
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql":   {Data: []byte("CREATE TABLE foo (id int);")},
+		"0001_foo.down.sql": {Data: []byte("DROP TABLE foo;")},
+		"0002_bar.up.sql":   {Data: []byte("CREATE TABLE bar (id int); CREATE INDEX bar_id ON bar (id);")},
+		"0002_bar.down.sql": {Data: []byte("DROP TABLE bar;")},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	migrations = append(migrations, migration{
+		version: 3,
+		up:      emptyMigrationFunc,
+		down:    emptyMigrationFunc,
+		file:    "0003_baz.go",
+	})
+
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	if err := PrintUp(db, &buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `-- migration 2 (0002_bar.up.sql)
+CREATE TABLE bar (id int);
+CREATE INDEX bar_id ON bar (id);
+UPDATE "__version" SET version = 2, updated_at = T;
+INSERT INTO "__version_log" (version, direction, applied_at, outcome, message) VALUES (2, 'up', T, 'success', NULL);
+
+-- migration 3 (0003_baz.go) is written in Go, its SQL is not statically known
+UPDATE "__version" SET version = 3, updated_at = T;
+INSERT INTO "__version_log" (version, direction, applied_at, outcome, message) VALUES (3, 'up', T, 'success', NULL);
+
+`
+	result := timestampRegex.ReplaceAllString(buf.String(), "T")
+	if result != expected {
+		t.Errorf("unexpected script:\n\t(GOT): %s\n\t(WNT): %s", result, expected)
+	}
+
+	if _, err := db.Exec("SELECT * FROM bar"); err == nil {
+		t.Errorf("expecting migrations not to be run")
+	}
+}
+
+func TestPrintUp_NotInitialized(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(1)
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer db.Close()
+
+	var buf bytes.Buffer
+	if err := PrintUp(db, &buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), `CREATE TABLE IF NOT EXISTS "__version"`) {
+		t.Errorf("expecting script to create the version table, got: %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), `CREATE TABLE IF NOT EXISTS "__version_log"`) {
+		t.Errorf("expecting script to create the migration log, got: %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), `INSERT INTO "__version" (version, updated_at) VALUES (1, `) {
+		t.Errorf("expecting script to insert the version, got: %s", buf.String())
+	}
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ok {
+		t.Errorf("expecting version table not to be created")
+	}
+}
+
+func TestPrintUp_NoPendingMigrations(t *testing.T) {
+	defer reset()
+	migrations = generateMigrations(1)
+	db, cleanup := initTest(t, 1)
+	defer cleanup()
+
+	if err := PrintUp(db, new(bytes.Buffer)); err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
+
+func TestRollbackScript(t *testing.T) {
+	defer reset()
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql":   {Data: []byte("CREATE TABLE foo (id int);")},
+		"0001_foo.down.sql": {Data: []byte("DROP TABLE foo;")},
+		"0002_bar.up.sql":   {Data: []byte("CREATE TABLE bar (id int); CREATE INDEX bar_id ON bar (id);")},
+		"0002_bar.down.sql": {Data: []byte("DROP INDEX bar_id; DROP TABLE bar;")},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	migrations = append(migrations, migration{
+		version: 3,
+		up:      emptyMigrationFunc,
+		down:    emptyMigrationFunc,
+		file:    "0003_baz.go",
+	}, migration{
+		version:      4,
+		up:           emptyMigrationFunc,
+		file:         "0004_qux.go",
+		irreversible: true,
+	})
+
+	script, err := RollbackScript(2, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `-- migration 4 (0004_qux.go) is irreversible, it can't be rolled back
+
+-- migration 3 (0003_baz.go) is written in Go, its SQL is not statically known
+
+-- migration 2 (0002_bar.down.sql)
+DROP INDEX bar_id;
+DROP TABLE bar;
+`
+	if script != expected {
+		t.Errorf("unexpected script:\n\t(GOT): %s\n\t(WNT): %s", script, expected)
+	}
+
+	if _, err := RollbackScript(3, 1); err == nil {
+		t.Errorf("expecting error with invalid range")
+	}
+
+	if _, err := RollbackScript(5, 10); err != ErrNoPendingMigrations {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, ErrNoPendingMigrations)
+	}
+}
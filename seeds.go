@@ -0,0 +1,106 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// seed is a function registered with RegisterSeed.
+type seed struct {
+	name string
+	fn   MigrationFunc
+}
+
+// seeds are the registered seeds in the order they were registered.
+var seeds []seed
+
+// RegisterSeed adds a new seed, that is, a function that keeps the reference
+// data of the database in sync, such as the rows of lookup tables. Unlike
+// migrations, seeds are run every time Seed is called, so they must be safe to
+// run more than once, e.g. using upserts. They are identified by their name
+// and are run in the order they were registered.
+func RegisterSeed(name string, fn MigrationFunc) {
+	if fn == nil {
+		panic(fmt.Errorf("seeds cannot be nil in register"))
+	}
+
+	if name == "" {
+		panic(fmt.Errorf("seed name cannot be empty"))
+	}
+
+	for _, s := range seeds {
+		if s.name == name {
+			panic(fmt.Errorf("seed %q has already been registered", name))
+		}
+	}
+
+	seeds = append(seeds, seed{name, fn})
+}
+
+// Seed runs all the registered seeds in the order they were registered. It is
+// meant to be called after Up. If tx is true, all seeds will be run inside a
+// transaction. The version table is not read nor modified.
+func Seed(db *sql.DB, tx bool) error {
+	return runSeeds(db, tx, seeds)
+}
+
+// SeedOnly runs the registered seeds with the given names inside a
+// transaction, in the order they were registered, regardless of the order of
+// the names. It fails without running any seed if any of the names is not
+// the name of a registered seed.
+func SeedOnly(db *sql.DB, names ...string) error {
+	selected, err := seedsNamed(names)
+	if err != nil {
+		return err
+	}
+	return runSeeds(db, true, selected)
+}
+
+// seedsNamed returns the registered seeds with the given names, in the order
+// they were registered.
+func seedsNamed(names []string) ([]seed, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+
+	var selected []seed
+	var available []string
+	for _, s := range seeds {
+		if wanted[s.name] {
+			selected = append(selected, s)
+			delete(wanted, s.name)
+		}
+		available = append(available, s.name)
+	}
+
+	if len(wanted) > 0 {
+		var unknown []string
+		for _, n := range names {
+			if wanted[n] {
+				unknown = append(unknown, n)
+				delete(wanted, n)
+			}
+		}
+
+		return nil, fmt.Errorf(
+			"unknown seeds %s, available seeds are: %s",
+			strings.Join(unknown, ", "),
+			strings.Join(available, ", "),
+		)
+	}
+
+	return selected, nil
+}
+
+func runSeeds(db *sql.DB, tx bool, seeds []seed) error {
+	return runBatch(querierOf(db), tx, func(db DB) error {
+		for _, s := range seeds {
+			if err := s.fn(db); err != nil {
+				return fmt.Errorf("error running seed %s: %s", s.name, err)
+			}
+		}
+		return nil
+	})
+}
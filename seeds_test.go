@@ -0,0 +1,87 @@
+package mig
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSeed(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterSeed("countries", newMigrationFunc(1, migrationUp, nil))
+	RegisterSeed("currencies", newMigrationFunc(2, migrationUp, nil))
+
+	for i := 0; i < 2; i++ {
+		if err := Seed(db, true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	assertMigration(t, []int64{1, 2, 1, 2}, migrationUp, db)
+}
+
+func TestSeed_Error(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterSeed("countries", newMigrationFunc(1, migrationUp, nil))
+	RegisterSeed("currencies", newMigrationFunc(2, migrationUp, errors.New("boom")))
+
+	if err := Seed(db, true); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+}
+
+func TestRegisterSeed_Duplicated(t *testing.T) {
+	defer reset()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expecting panic")
+		}
+	}()
+
+	RegisterSeed("countries", emptyMigrationFunc)
+	RegisterSeed("countries", emptyMigrationFunc)
+}
+
+func TestSeedOnly(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterSeed("countries", newMigrationFunc(1, migrationUp, nil))
+	RegisterSeed("currencies", newMigrationFunc(2, migrationUp, nil))
+	RegisterSeed("languages", newMigrationFunc(3, migrationUp, nil))
+
+	if err := SeedOnly(db, "languages", "countries"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1, 3}, migrationUp, db)
+}
+
+func TestSeedOnly_Unknown(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	RegisterSeed("countries", newMigrationFunc(1, migrationUp, nil))
+	RegisterSeed("currencies", newMigrationFunc(2, migrationUp, nil))
+
+	err := SeedOnly(db, "countries", "planets")
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	expected := "unknown seeds planets, available seeds are: countries, currencies"
+	if err.Error() != expected {
+		t.Errorf("unexpected error:\n\t(GOT): %s\n\t(WNT): %s", err, expected)
+	}
+
+	assertMigration(t, nil, migrationUp, db)
+}
@@ -0,0 +1,303 @@
+package mig
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var statementHook func(stmt string) (string, error)
+
+// SetStatementHook sets a function that is called with every statement of the
+// migrations loaded from SQL files right before executing it. The hook can
+// return a different statement to execute instead, or an error to abort the
+// migration. Migrations written in Go are not affected by it.
+func SetStatementHook(hook func(stmt string) (string, error)) {
+	statementHook = hook
+}
+
+var resultInspector func(version int64, res sql.Result) error
+
+// SetResultInspector sets a function that is called with the result of every
+// statement executed by the migrations loaded from SQL files, e.g. to check
+// the number of rows affected. If it returns an error, the migration fails.
+// Since database/sql does not expose warnings raised by the database, this is
+// the place to turn unexpected results into errors.
+func SetResultInspector(inspector func(version int64, res sql.Result) error) {
+	resultInspector = inspector
+}
+
+// LoadSQLDir registers as migrations all the SQL migration files in the given
+// directory. See LoadSQLFS for the conventions the files must follow. It can
+// be called with several directories, e.g. one for the core of an application
+// and one for each of its plugins, and all their migrations are run in a
+// single order by version. If a version is used in more than one directory,
+// it fails without registering any migration of the directory.
+func LoadSQLDir(dir string) error {
+	return loadSQLFS(os.DirFS(dir), dir)
+}
+
+// LoadSQLFS registers as migrations all the SQL migration files in the root of
+// the given file system, which can be an embed.FS to bundle the migrations
+// inside the binary. Every migration needs two files, NUMBER_NAME.up.sql and
+// NUMBER_NAME.down.sql, and they can contain more than one statement as long
+// as they are separated with semicolons. Files that are not SQL files are
+// ignored.
+func LoadSQLFS(fsys fs.FS) error {
+	return loadSQLFS(fsys, "")
+}
+
+// loadSQLFS registers the SQL migrations in the given file system, whose files
+// are recorded as being in the given directory.
+func loadSQLFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("unable to read sql migrations: %s", err)
+	}
+
+	var files = make(map[int64]*sqlFiles)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		v, err := versionFromSQLFile(name)
+		if err != nil {
+			return err
+		}
+
+		f, ok := files[v]
+		if !ok {
+			f = new(sqlFiles)
+			files[v] = f
+		}
+
+		if strings.HasSuffix(name, ".up.sql") {
+			if f.up != "" {
+				return fmt.Errorf("sql migration %d has two up files: %s and %s", v, f.up, name)
+			}
+			f.up = name
+		} else {
+			if f.down != "" {
+				return fmt.Errorf("sql migration %d has two down files: %s and %s", v, f.down, name)
+			}
+			f.down = name
+		}
+	}
+
+	var versions = make([]int64, 0, len(files))
+	for v := range files {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	var errs []error
+	for _, v := range versions {
+		f := files[v]
+		if f.up == "" || f.down == "" {
+			return fmt.Errorf("sql migration %d needs both an up and a down file", v)
+		}
+
+		for _, m := range migrations {
+			if m.version == v {
+				errs = append(errs, fmt.Errorf(
+					"sql migration %d in file %s has already been registered in file %s",
+					v, filepath.Join(dir, f.up), m.file,
+				))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, v := range versions {
+		f := files[v]
+		up, err := readStatements(fsys, f.up)
+		if err != nil {
+			return err
+		}
+
+		down, err := readStatements(fsys, f.down)
+		if err != nil {
+			return err
+		}
+
+		err = addMigration(migration{
+			version: v,
+			up:      execStatements(v, up),
+			down:    execStatements(v, down),
+			file:    filepath.Join(dir, f.up),
+			upSQL:   up,
+			downSQL: down,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type sqlFiles struct {
+	up   string
+	down string
+}
+
+func readStatements(fsys fs.FS, file string) ([]string, error) {
+	content, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sql migration file %s: %s", file, err)
+	}
+
+	return SplitStatements(string(content)), nil
+}
+
+func execStatements(version int64, stmts []string) MigrationFunc {
+	return func(db DB) error {
+		db = CountingDB{db}
+		for _, stmt := range stmts {
+			if statementHook != nil {
+				var err error
+				stmt, err = statementHook(stmt)
+				if err != nil {
+					return err
+				}
+			}
+
+			res, err := db.Exec(stmt, execModeArgs()...)
+			if err != nil {
+				return err
+			}
+
+			if resultInspector != nil {
+				if err := resultInspector(version, res); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// noSplitMarker is the comment that makes a SQL migration file be run as a
+// single statement instead of being split by semicolons, e.g. for trigger
+// bodies with BEGIN ... END blocks.
+const noSplitMarker = "-- mig:no-split"
+
+// SplitStatements splits the given SQL in the statements separated by
+// semicolons the same way SQL migration files are split, ignoring the ones
+// inside quotes, PostgreSQL dollar-quoted strings and comments. Comments are
+// removed from the statements. If a line of the SQL is the "-- mig:no-split"
+// marker, the rest of the SQL is returned as a single statement.
+func SplitStatements(sql string) []string {
+	if stmt, ok := unsplitStatement(sql); ok {
+		if stmt == "" {
+			return nil
+		}
+		return []string{stmt}
+	}
+
+	var (
+		stmts []string
+		buf   strings.Builder
+		quote rune
+	)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(buf.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		buf.Reset()
+	}
+
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '$':
+			if tag := dollarTag(runes[i:]); tag != "" {
+				// copy everything up to the closing tag, or the rest of the
+				// SQL if the string is not closed
+				n := utf8.RuneCountInString(tag)
+				rest := string(runes[i+n:])
+				if end := strings.Index(rest, tag); end >= 0 {
+					rest = rest[:end+len(tag)]
+				}
+
+				buf.WriteString(tag + rest)
+				i += n + utf8.RuneCountInString(rest) - 1
+				continue
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			buf.WriteRune('\n')
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			buf.WriteRune(' ')
+			continue
+		case r == ';':
+			flush()
+			continue
+		}
+
+		buf.WriteRune(r)
+	}
+	flush()
+
+	return stmts
+}
+
+// dollarTag returns the PostgreSQL dollar-quoting tag the given SQL starts
+// with, such as $$ or $body$, or an empty string if it does not start with
+// one. Positional parameters such as $1 are not tags.
+func dollarTag(sql []rune) string {
+	for i := 1; i < len(sql); i++ {
+		r := sql[i]
+		switch {
+		case r == '$':
+			return string(sql[:i+1])
+		case r == '_' || unicode.IsLetter(r) || (i > 1 && unicode.IsDigit(r)):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// unsplitStatement returns the given SQL without the no-split marker as a
+// single statement if it has a line with the marker.
+func unsplitStatement(sql string) (string, bool) {
+	lines := strings.Split(sql, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == noSplitMarker {
+			lines = append(lines[:i:i], lines[i+1:]...)
+			return strings.TrimSpace(strings.Join(lines, "\n")), true
+		}
+	}
+	return "", false
+}
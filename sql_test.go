@@ -0,0 +1,268 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{"empty", "  \n ", nil},
+		{"single", "CREATE TABLE foo (id int)", []string{"CREATE TABLE foo (id int)"}},
+		{"multiple", "CREATE TABLE foo (id int);\nCREATE TABLE bar (id int);\n", []string{
+			"CREATE TABLE foo (id int)",
+			"CREATE TABLE bar (id int)",
+		}},
+		{"quotes", `INSERT INTO foo VALUES ('a;b', "c;d");`, []string{`INSERT INTO foo VALUES ('a;b', "c;d")`}},
+		{"comments", "-- a comment; with semicolon\nSELECT 1; /* another; comment */ SELECT 2;", []string{
+			"SELECT 1",
+			"SELECT 2",
+		}},
+		{"dollar quotes", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\nSELECT $1;", []string{
+			"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql",
+			"SELECT $1",
+		}},
+		{"tagged dollar quotes", "DO $body$ BEGIN PERFORM 'a;b'; $$; END $body$; SELECT 1;", []string{
+			"DO $body$ BEGIN PERFORM 'a;b'; $$; END $body$",
+			"SELECT 1",
+		}},
+		{"no split", "-- mig:no-split\nCREATE TRIGGER t AFTER INSERT ON foo BEGIN\n\tDELETE FROM bar;\nEND;\n", []string{
+			"CREATE TRIGGER t AFTER INSERT ON foo BEGIN\n\tDELETE FROM bar;\nEND;",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SplitStatements(tt.sql)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("unexpected result:\n\t(GOT): %q\n\t(WNT): %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadSQLFS(t *testing.T) {
+	defer reset()
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql":   {Data: []byte("INSERT INTO migrations_run (version, migration_type) VALUES (1, 0);")},
+		"0001_foo.down.sql": {Data: []byte("INSERT INTO migrations_run (version, migration_type) VALUES (1, 1);")},
+		"0002_bar.up.sql": {Data: []byte(`
+			CREATE TABLE bar (id int);
+			INSERT INTO migrations_run (version, migration_type) VALUES (2, 0);
+		`)},
+		"0002_bar.down.sql": {Data: []byte(`
+			DROP TABLE bar;
+			INSERT INTO migrations_run (version, migration_type) VALUES (2, 1);
+		`)},
+		"README.md": {Data: []byte("not a migration")},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	if _, _, err := ToVersion(db, true, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{2, 1}, migrationDown, db)
+}
+
+func TestLoadSQLDir_Multiple(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	sqlMigration := func(version int64) fileCreator {
+		return func(dir string) error {
+			for typ, ext := range []string{"up", "down"} {
+				name := fmt.Sprintf("%04d_foo.%s.sql", version, ext)
+				stmt := fmt.Sprintf("INSERT INTO migrations_run (version, migration_type) VALUES (%d, %d);", version, typ)
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(stmt), 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	structure := []fileCreator{
+		dir("core", 0777, sqlMigration(1), sqlMigration(3)),
+		dir("plugin", 0777, sqlMigration(2), sqlMigration(4)),
+		dir("other", 0777, sqlMigration(3), sqlMigration(5)),
+	}
+	for _, fn := range structure {
+		if err := fn(base); err != nil {
+			t.Fatalf("unexpected error creating structure for test: %s", err)
+		}
+	}
+
+	for _, d := range []string{"core", "plugin"} {
+		if err := LoadSQLDir(filepath.Join(base, d)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	err = LoadSQLDir(filepath.Join(base, "other"))
+	if err == nil {
+		t.Fatalf("expecting error with colliding versions")
+	}
+
+	for _, path := range []string{
+		filepath.Join(base, "core", "0003_foo.up.sql"),
+		filepath.Join(base, "other", "0003_foo.up.sql"),
+	} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("expecting error to contain %s: %s", path, err)
+		}
+	}
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertMigration(t, []int64{1, 2, 3, 4}, migrationUp, db)
+}
+
+func TestLoadSQLFS_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_foo.up.sql": {Data: []byte("SELECT 1")},
+		}},
+		{"invalid name", fstest.MapFS{
+			"foo.up.sql": {Data: []byte("SELECT 1")},
+		}},
+		{"two up files", fstest.MapFS{
+			"0001_foo.up.sql":   {Data: []byte("SELECT 1")},
+			"0001_bar.up.sql":   {Data: []byte("SELECT 1")},
+			"0001_foo.down.sql": {Data: []byte("SELECT 1")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer reset()
+			if err := LoadSQLFS(tt.fsys); err == nil {
+				t.Errorf("expecting an error")
+			}
+		})
+	}
+}
+
+func TestLoadSQLFS_StatementHook(t *testing.T) {
+	defer reset()
+	defer SetStatementHook(nil)
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql": {Data: []byte(`
+			INSERT INTO migrations_run (version, migration_type) VALUES (1, 0);
+			INSERT INTO migrations_run (version, migration_type) VALUES (2, 0);
+		`)},
+		"0001_foo.down.sql": {Data: []byte(`
+			INSERT INTO migrations_run (version, migration_type) VALUES (1, 1);
+			DROP TABLE migrations_run;
+		`)},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var seen []string
+	SetStatementHook(func(stmt string) (string, error) {
+		seen = append(seen, stmt)
+		if strings.HasPrefix(stmt, "DROP") {
+			return "", fmt.Errorf("drop is not allowed")
+		}
+		return strings.Replace(stmt, "(2, 0)", "(3, 0)", 1), nil
+	})
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 3}, migrationUp, db)
+
+	if _, _, err := Down(db, true); err == nil {
+		t.Errorf("expecting an error")
+	}
+	assertMigration(t, nil, migrationDown, db)
+
+	if len(seen) != 4 {
+		t.Errorf("unexpected number of statements seen by the hook:\n\t(GOT): %d\n\t(WNT): %d", len(seen), 4)
+	}
+}
+
+func TestLoadSQLFS_ResultInspector(t *testing.T) {
+	defer reset()
+	defer SetResultInspector(nil)
+	fsys := fstest.MapFS{
+		"0001_foo.up.sql": {Data: []byte(`
+			INSERT INTO migrations_run (version, migration_type) VALUES (1, 0);
+		`)},
+		"0001_foo.down.sql": {Data: []byte(`
+			UPDATE migrations_run SET migration_type = 1 WHERE version = 42;
+		`)},
+	}
+
+	if err := LoadSQLFS(fsys); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var versions []int64
+	SetResultInspector(func(version int64, res sql.Result) error {
+		versions = append(versions, version)
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return fmt.Errorf("no rows affected")
+		}
+		return nil
+	})
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Down(db, true); err == nil {
+		t.Errorf("expecting an error")
+	}
+
+	if !reflect.DeepEqual(versions, []int64{1, 1}) {
+		t.Errorf("unexpected versions:\n\t(GOT): %v\n\t(WNT): %v", versions, []int64{1, 1})
+	}
+}
@@ -0,0 +1,109 @@
+package mig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// VersionStore keeps track of the version of the database somewhere else than
+// in the database itself, so it survives the schema being dropped and
+// recreated.
+type VersionStore interface {
+	// Current returns the current version of the database, or 0 if it was
+	// never set.
+	Current() (int64, error)
+	// Set sets the current version of the database.
+	Set(version int64) error
+	// Applied returns all the versions the database has been set to, from
+	// the oldest to the newest.
+	Applied() ([]int64, error)
+}
+
+var versionStore VersionStore
+
+// errExternalStore is returned by the operations that need the version table
+// when an external store was set with SetExternalStore.
+var errExternalStore = errors.New("the version table and the migration log are not used with an external version store")
+
+// SetExternalStore sets the store used to keep track of the version of the
+// database instead of the version table. Neither the version table nor the
+// migration log are created then, so the history of the database can only be
+// retrieved from the store. A nil store, which is the default, restores the
+// version table.
+//
+// Keep in mind that the store is not part of the transactions migrations run
+// in, so if a transaction can not be committed after the version was set the
+// store will be ahead of the database.
+func SetExternalStore(store VersionStore) {
+	versionStore = store
+}
+
+// storeVersionInfo returns the current version in the external store and
+// whether any version was ever set.
+func storeVersionInfo() (version int64, initialized bool, err error) {
+	applied, err := versionStore.Applied()
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to read applied versions from store: %s", err)
+	}
+
+	version, err = versionStore.Current()
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to read current version from store: %s", err)
+	}
+
+	return version, len(applied) > 0, nil
+}
+
+// FileStore is a VersionStore that keeps the versions the database has been
+// set to in a JSON file at Path, which is created when the version is set for
+// the first time. It's meant as a reference implementation and for CI
+// pipelines; it is not safe to use from several processes at the same time.
+type FileStore struct {
+	Path string
+}
+
+// Current implements the VersionStore interface.
+func (s FileStore) Current() (int64, error) {
+	applied, err := s.Applied()
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1], nil
+}
+
+// Set implements the VersionStore interface.
+func (s FileStore) Set(version int64) error {
+	applied, err := s.Applied()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(append(applied, version))
+	if err != nil {
+		return fmt.Errorf("unable to encode versions: %s", err)
+	}
+
+	if err := ioutil.WriteFile(s.Path, content, 0644); err != nil {
+		return fmt.Errorf("unable to write versions file: %s", err)
+	}
+	return nil
+}
+
+// Applied implements the VersionStore interface.
+func (s FileStore) Applied() ([]int64, error) {
+	content, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read versions file: %s", err)
+	}
+
+	var applied []int64
+	if err := json.Unmarshal(content, &applied); err != nil {
+		return nil, fmt.Errorf("unable to decode versions file %s: %s", s.Path, err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,84 @@
+package mig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSetExternalStore(t *testing.T) {
+	defer reset()
+
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	store := FileStore{filepath.Join(base, "versions.json")}
+	SetExternalStore(store)
+	migrations = generateMigrations(3)
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if _, initialized, err := CurrentVersionInfo(db); err != nil || initialized {
+		t.Fatalf("expecting store not to be initialized: %v", err)
+	}
+
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, _, err := Down(db, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+
+	applied, err := store.Applied()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(applied, []int64{3, 2}) {
+		t.Errorf("unexpected applied versions:\n\t(GOT): %v\n\t(WNT): %v", applied, []int64{3, 2})
+	}
+
+	ok, err := IsInitialized(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ok {
+		t.Errorf("expecting version table not to be created")
+	}
+
+	if err := Compact(db, 2); err != errExternalStore {
+		t.Errorf("unexpected error:\n\t(GOT): %v\n\t(WNT): %v", err, errExternalStore)
+	}
+}
+
+func TestFileStore_Invalid(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "test-mig-*.json")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("not json")
+	f.Close()
+
+	if _, err := (FileStore{f.Name()}).Current(); err == nil {
+		t.Errorf("expecting error with invalid file")
+	}
+}
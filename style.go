@@ -0,0 +1,58 @@
+package mig
+
+import "fmt"
+
+// Style is the way the body of a new migration is written.
+type Style string
+
+const (
+	// StyleExec writes a Go migration that runs a single statement with
+	// db.Exec. It's the style of the migrations written by Create.
+	StyleExec Style = "exec"
+	// StyleExecAll writes a Go migration that runs a list of statements with
+	// ExecAll.
+	StyleExecAll Style = "execall"
+	// StyleSQL writes a pair of NUMBER_NAME.up.sql and NUMBER_NAME.down.sql
+	// files, to be loaded with LoadSQLFS.
+	StyleSQL Style = "sql"
+)
+
+// CreateWithStyle creates a new migration written in the given style and
+// returns the names of the files created, which are two for StyleSQL. If
+// strict is true, it fails like CreateStrict when there are files in the
+// migrations directory that are not correctly named migrations.
+func CreateWithStyle(path, name string, style Style, strict bool) ([]string, error) {
+	switch style {
+	case StyleExec, "":
+		return createGo(path, name, strict, []byte(migrationTpl))
+	case StyleExecAll:
+		content, err := renderSQLMigration("", []string{"UP"}, []string{"DOWN"})
+		if err != nil {
+			return nil, err
+		}
+		return createGo(path, name, strict, content)
+	case StyleSQL:
+		return createFiles(path, strict, func(version int64) []migrationFile {
+			return []migrationFile{
+				{fmt.Sprintf("%04d_%s.up.sql", version, name), []byte(upSQLTpl)},
+				{fmt.Sprintf("%04d_%s.down.sql", version, name), []byte(downSQLTpl)},
+			}
+		})
+	default:
+		return nil, fmt.Errorf("unknown migration style %q, must be one of (%s, %s, %s)", style, StyleExec, StyleExecAll, StyleSQL)
+	}
+}
+
+func createGo(path, name string, strict bool, content []byte) ([]string, error) {
+	file, err := create(path, name, strict, content)
+	if err != nil {
+		return nil, err
+	}
+	return []string{file}, nil
+}
+
+const upSQLTpl = `-- statements of the up migration, separated by semicolons
+`
+
+const downSQLTpl = `-- statements of the down migration, separated by semicolons
+`
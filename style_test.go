@@ -0,0 +1,70 @@
+package mig
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateWithStyle(t *testing.T) {
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	dir := filepath.Join(base, "migrations")
+	tests := []struct {
+		style Style
+		files []string
+	}{
+		{StyleExec, []string{"0001_foo.go"}},
+		{StyleSQL, []string{"0002_foo.up.sql", "0002_foo.down.sql"}},
+		{StyleExecAll, []string{"0003_foo.go"}},
+	}
+
+	for _, tt := range tests {
+		files, err := CreateWithStyle(dir, "foo", tt.style, true)
+		if err != nil {
+			t.Fatalf("unexpected error with style %s: %s", tt.style, err)
+		}
+
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("unexpected files with style %s:\n\t(GOT): %v\n\t(WNT): %v", tt.style, files, tt.files)
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "0003_foo.go"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "0003_foo.go", content, 0); err != nil {
+		t.Errorf("unexpected error parsing migration: %s", err)
+	}
+
+	if !strings.Contains(string(content), "mig.ExecAll(db,") {
+		t.Errorf("expecting migration to use ExecAll, got:\n%s", content)
+	}
+
+	if errs := CheckDir(dir); len(errs) > 0 {
+		t.Errorf("unexpected errors checking dir: %v", errs)
+	}
+}
+
+func TestCreateWithStyle_Unknown(t *testing.T) {
+	base, err := ioutil.TempDir(os.TempDir(), "test-mig")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(base)
+
+	if _, err := CreateWithStyle(base, "foo", Style("orm"), false); err == nil {
+		t.Errorf("expecting error")
+	}
+}
@@ -0,0 +1,99 @@
+package mig
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	outcomeSkipped    = "skipped"
+	outcomeRolledBack = "rolled back"
+)
+
+// StepResult is the result of running a single migration.
+type StepResult struct {
+	Version int64
+	// Name of the migration, taken from its file name.
+	Name string
+	// Direction the migration was run in, either up or down.
+	Direction string
+	// Duration is how long the migration took to run.
+	Duration time.Duration
+	// Outcome of the migration, one of success, failed, skipped or rolled
+	// back, if it succeeded but the transaction it ran in was rolled back
+	// afterwards because another migration failed.
+	Outcome string
+}
+
+var steps = new(stepCollector)
+
+// Steps returns the results of all the migrations run during the last run, in
+// the order they were run, so a summary can be reported once it's finished.
+func Steps() []StepResult {
+	steps.mut.Lock()
+	defer steps.mut.Unlock()
+
+	var result = make([]StepResult, len(steps.list))
+	copy(result, steps.list)
+	return result
+}
+
+type stepCollector struct {
+	mut  sync.Mutex
+	list []StepResult
+}
+
+func (c *stepCollector) reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.list = nil
+}
+
+func (c *stepCollector) add(m migration, direction string, d time.Duration, err error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeFailed
+	}
+
+	c.list = append(c.list, StepResult{
+		Version:   m.version,
+		Name:      migrationName(m.file),
+		Direction: direction,
+		Duration:  d,
+		Outcome:   outcome,
+	})
+}
+
+func (c *stepCollector) skip(m migration, direction string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.list = append(c.list, StepResult{
+		Version:   m.version,
+		Name:      migrationName(m.file),
+		Direction: direction,
+		Outcome:   outcomeSkipped,
+	})
+}
+
+func (c *stepCollector) len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return len(c.list)
+}
+
+// rollBackSince marks the successful steps from the given index onwards as
+// rolled back.
+func (c *stepCollector) rollBackSince(i int) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for ; i < len(c.list); i++ {
+		if c.list[i].Outcome == outcomeSuccess {
+			c.list[i].Outcome = outcomeRolledBack
+		}
+	}
+}
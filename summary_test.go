@@ -0,0 +1,54 @@
+package mig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSteps(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("boom"))
+
+	if _, _, err := Up(db, true); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	assertSteps := func(expected []string) {
+		t.Helper()
+		var outcomes []string
+		for _, s := range Steps() {
+			outcomes = append(outcomes, s.Outcome)
+		}
+
+		if !reflect.DeepEqual(outcomes, expected) {
+			t.Errorf("unexpected outcomes:\n\t(GOT): %v\n\t(WNT): %v", outcomes, expected)
+		}
+	}
+
+	// the first migration was rolled back along with the transaction
+	assertSteps([]string{outcomeRolledBack, outcomeFailed})
+
+	migrations[1].up = newMigrationFunc(2, migrationUp, nil)
+	if _, _, err := Up(db, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertSteps([]string{outcomeSuccess, outcomeSuccess, outcomeSuccess})
+
+	steps := Steps()
+	if steps[2].Version != 3 || steps[2].Direction != directionUp || steps[2].Name != "test" {
+		t.Errorf("unexpected step: %+v", steps[2])
+	}
+
+	if _, _, err := Down(db, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if steps := Steps(); len(steps) != 1 || steps[0].Direction != directionDown {
+		t.Errorf("unexpected steps: %+v", steps)
+	}
+}
@@ -0,0 +1,39 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tracer starts a span with the given name as a child of the span in the
+// given context, if any. It returns the context with the new span and the
+// function that ends it with the error the traced operation finished with,
+// which is nil if it succeeded.
+type Tracer func(ctx context.Context, name string) (context.Context, func(error))
+
+var tracer Tracer
+
+// SetTracer sets the tracer used to wrap migration runs in spans, e.g. to
+// wire them to OpenTelemetry. There is a span for every batch of migrations,
+// named "migrations up" or "migrations down", and a child span for every
+// migration of the batch, named "migration N up" or "migration N down". By
+// default, or if the given tracer is nil, nothing is traced.
+func SetTracer(t Tracer) {
+	tracer = t
+}
+
+// startSpan starts a span with the tracer set with SetTracer.
+func startSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	if tracer == nil {
+		return ctx, func(error) {}
+	}
+	return tracer(ctx, name)
+}
+
+func batchSpanName(direction string) string {
+	return fmt.Sprintf("migrations %s", direction)
+}
+
+func migrationSpanName(version int64, direction string) string {
+	return fmt.Sprintf("migration %d %s", version, direction)
+}
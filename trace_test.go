@@ -0,0 +1,60 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type spanKey struct{}
+
+func TestSetTracer(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(2)
+	migrations[1].up = newMigrationFunc(2, migrationUp, errors.New("boom"))
+
+	var spans []string
+	SetTracer(func(ctx context.Context, name string) (context.Context, func(error)) {
+		if parent, ok := ctx.Value(spanKey{}).(string); ok {
+			name = parent + " > " + name
+		}
+
+		return context.WithValue(ctx, spanKey{}, name), func(err error) {
+			if err != nil {
+				name += " (error)"
+			}
+			spans = append(spans, name)
+		}
+	})
+	defer SetTracer(nil)
+
+	if _, _, err := Up(db, false); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	expected := []string{
+		"migrations up > migration 1 up",
+		"migrations up > migration 2 up (error)",
+		"migrations up (error)",
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("unexpected spans:\n\t(GOT): %v\n\t(WNT): %v", spans, expected)
+	}
+
+	spans = nil
+	if _, _, err := Down(db, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected = []string{
+		"migrations down > migration 1 down",
+		"migrations down",
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("unexpected spans:\n\t(GOT): %v\n\t(WNT): %v", spans, expected)
+	}
+}
@@ -0,0 +1,115 @@
+package mig
+
+import "database/sql"
+
+// TxMode is the way migrations are wrapped in transactions when they are run.
+type TxMode int
+
+const (
+	// TxNone runs migrations outside of a transaction. The version is
+	// recorded after every migration, so if one fails the database is left
+	// at the version of the last migration that succeeded.
+	TxNone TxMode = iota
+	// TxPerMigration runs every migration, along with recording its version,
+	// inside its own transaction. Each migration is atomic, and if one fails,
+	// the database is left at the version of the last one that succeeded.
+	TxPerMigration
+	// TxBatch runs all the migrations inside a single transaction, so either
+	// all of them are applied or none.
+	TxBatch
+)
+
+func (m TxMode) String() string {
+	switch m {
+	case TxNone:
+		return "none"
+	case TxPerMigration:
+		return "per-migration"
+	case TxBatch:
+		return "batch"
+	default:
+		return "unknown"
+	}
+}
+
+// txModeFor returns the mode equivalent to the tx argument of the functions
+// running migrations.
+func txModeFor(tx bool) TxMode {
+	if tx {
+		return TxBatch
+	}
+	return TxNone
+}
+
+// UpMode runs all the pending database migrations until it's up to date,
+// using the given mode to wrap them in transactions. Other than that, it
+// works exactly like Up.
+func UpMode(db *sql.DB, mode TxMode) (oldVersion, newVersion int64, err error) {
+	return up(querierOf(db), mode)
+}
+
+// ToVersionMode executes up or down migrations from the current version
+// until the target version, using the given mode to wrap them in
+// transactions. Other than that, it works exactly like ToVersion.
+func ToVersionMode(db *sql.DB, mode TxMode, v int64) (oldVersion, newVersion int64, err error) {
+	return toVersion(querierOf(db), mode, v)
+}
+
+// migrationGroup is a group of consecutive migrations that are run either
+// all inside the same transaction or all outside of one.
+type migrationGroup struct {
+	tx         bool
+	migrations []migration
+}
+
+// groupByTx splits the given migrations in the groups that are run in the
+// same transaction according to the given mode. The ones registered with
+// NoTransaction always run outside of a transaction.
+func groupByTx(migrations []migration, mode TxMode) []migrationGroup {
+	var groups []migrationGroup
+	for _, m := range migrations {
+		tx := mode != TxNone && !m.noTx
+		if n := len(groups); n > 0 && groups[n-1].tx == tx && (mode != TxPerMigration || !tx) {
+			groups[n-1].migrations = append(groups[n-1].migrations, m)
+			continue
+		}
+
+		groups = append(groups, migrationGroup{tx, []migration{m}})
+	}
+	return groups
+}
+
+var checkpointEvery int
+
+// SetCheckpointEvery sets the number of migrations after which the
+// transaction they run in is committed and a new one is started when applying
+// migrations, recording the version at every checkpoint. A failure then only
+// loses the migrations applied since the last checkpoint. It only makes a
+// difference with TxBatch. A value of 0, which is the default, means all the
+// migrations run in a single transaction.
+func SetCheckpointEvery(n int) {
+	checkpointEvery = n
+}
+
+// withCheckpoints splits the given groups run inside a transaction in groups
+// of at most the number of migrations set with SetCheckpointEvery.
+func withCheckpoints(groups []migrationGroup) []migrationGroup {
+	if checkpointEvery <= 0 {
+		return groups
+	}
+
+	var result []migrationGroup
+	for _, g := range groups {
+		if !g.tx {
+			result = append(result, g)
+			continue
+		}
+
+		for len(g.migrations) > checkpointEvery {
+			result = append(result, migrationGroup{true, g.migrations[:checkpointEvery]})
+			g.migrations = g.migrations[checkpointEvery:]
+		}
+		result = append(result, g)
+	}
+	return result
+}
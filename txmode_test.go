@@ -0,0 +1,168 @@
+package mig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUpMode_Failure(t *testing.T) {
+	testCases := []struct {
+		mode     TxMode
+		applied  []int64
+		expected int64
+	}{
+		// everything is rolled back
+		{TxBatch, nil, 0},
+		// the migrations before the failing one were committed
+		{TxPerMigration, []int64{1, 2}, 2},
+		// the failed migration is only partially applied
+		{TxNone, []int64{1, 2, 3}, 2},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			defer reset()
+			db, cleanup := initTest(t, 0)
+			defer cleanup()
+
+			migrations = generateMigrations(4)
+			migrations[2].up = newMigrationFunc(3, migrationUp, errors.New("boom"))
+
+			if _, _, err := UpMode(db, tt.mode); err == nil {
+				t.Fatalf("expecting error")
+			}
+
+			assertMigration(t, tt.applied, migrationUp, db)
+
+			v, err := CurrentVersion(db)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if v != tt.expected {
+				t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToVersionMode_PerMigration(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 3)
+	defer cleanup()
+
+	migrations = generateMigrations(3)
+	migrations[0].down = newMigrationFunc(1, migrationDown, errors.New("boom"))
+
+	if _, _, err := ToVersionMode(db, TxPerMigration, 0); err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	assertMigration(t, []int64{3, 2}, migrationDown, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 1 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 1)
+	}
+}
+
+func TestGroupByTx(t *testing.T) {
+	ms := generateMigrations(4)
+	ms[2].noTx = true
+
+	testCases := []struct {
+		mode   TxMode
+		groups [][]int64
+		txs    []bool
+	}{
+		{TxBatch, [][]int64{{1, 2}, {3}, {4}}, []bool{true, false, true}},
+		{TxPerMigration, [][]int64{{1}, {2}, {3}, {4}}, []bool{true, true, false, true}},
+		{TxNone, [][]int64{{1, 2, 3, 4}}, []bool{false}},
+	}
+
+	for _, tt := range testCases {
+		var groups [][]int64
+		var txs []bool
+		for _, g := range groupByTx(ms, tt.mode) {
+			var versions []int64
+			for _, m := range g.migrations {
+				versions = append(versions, m.version)
+			}
+			groups = append(groups, versions)
+			txs = append(txs, g.tx)
+		}
+
+		if !reflect.DeepEqual(groups, tt.groups) {
+			t.Errorf("unexpected groups for %s:\n\t(GOT): %v\n\t(WNT): %v", tt.mode, groups, tt.groups)
+		}
+
+		if !reflect.DeepEqual(txs, tt.txs) {
+			t.Errorf("unexpected transactions for %s:\n\t(GOT): %v\n\t(WNT): %v", tt.mode, txs, tt.txs)
+		}
+	}
+}
+
+func TestSetCheckpointEvery(t *testing.T) {
+	defer reset()
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	migrations = generateMigrations(5)
+	migrations[3].up = newMigrationFunc(4, migrationUp, errors.New("boom"))
+	SetCheckpointEvery(2)
+
+	_, newVersion, err := UpMode(db, TxBatch)
+	if err == nil {
+		t.Fatalf("expecting error")
+	}
+
+	if newVersion != 4 {
+		t.Errorf("unexpected failed version:\n\t(GOT): %d\n\t(WNT): %d", newVersion, 4)
+	}
+
+	// the first checkpoint was committed, the migrations after it were
+	// rolled back
+	assertMigration(t, []int64{1, 2}, migrationUp, db)
+
+	v, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if v != 2 {
+		t.Errorf("unexpected version:\n\t(GOT): %d\n\t(WNT): %d", v, 2)
+	}
+
+	migrations[3].up = newMigrationFunc(4, migrationUp, nil)
+	if _, _, err := UpMode(db, TxBatch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertMigration(t, []int64{1, 2, 3, 4, 5}, migrationUp, db)
+}
+
+func TestWithCheckpoints(t *testing.T) {
+	defer SetCheckpointEvery(0)
+
+	ms := generateMigrations(5)
+	ms[2].noTx = true
+	SetCheckpointEvery(1)
+
+	var sizes []int
+	for _, g := range withCheckpoints(groupByTx(ms, TxBatch)) {
+		sizes = append(sizes, len(g.migrations))
+	}
+
+	if !reflect.DeepEqual(sizes, []int{1, 1, 1, 1, 1}) {
+		t.Errorf("unexpected group sizes:\n\t(GOT): %v\n\t(WNT): %v", sizes, []int{1, 1, 1, 1, 1})
+	}
+
+	SetCheckpointEvery(0)
+	if groups := withCheckpoints(groupByTx(ms, TxBatch)); len(groups) != 3 {
+		t.Errorf("unexpected number of groups:\n\t(GOT): %d\n\t(WNT): %d", len(groups), 3)
+	}
+}
@@ -1,6 +1,13 @@
 package mig
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // ExecAll is an utility function to execute all the given migrations.
 // This is specially useful for running a bunch of create tables and so on.
@@ -28,3 +35,583 @@ func DropAll(db DB, tables ...string) error {
 	}
 	return nil
 }
+
+// ExecFile is an utility function to execute all the statements of a SQL
+// file, separated by semicolons, so Go migrations can keep bulky DDL in .sql
+// files. The path is relative to the working directory of the process
+// running the migrations, not to the migration file.
+//  ExecFile(db, "migrations/sql/0001_initial_schema.sql")
+func ExecFile(db DB, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read sql file %s: %s", path, err)
+	}
+
+	for i, stmt := range SplitStatements(string(content)) {
+		if _, err := db.Exec(stmt, execModeArgs()...); err != nil {
+			return fmt.Errorf("unable to execute statement %d of sql file %s: %s", i+1, path, err)
+		}
+	}
+
+	return nil
+}
+
+// limitMarker is the marker that BatchExec replaces in the query with the
+// clause limiting the number of rows of a batch.
+const limitMarker = "{limit}"
+
+// BatchExec is an utility function to run an UPDATE or DELETE affecting a lot
+// of rows in batches of batchSize rows, so a single statement does not need to
+// hold all of them at once. The query must contain the {limit} marker, which is
+// replaced with the clause limiting the rows for the dialect in use, and must
+// exclude the rows already processed, because it is run until it does not
+// affect any row.
+//  BatchExec(db, `DELETE FROM foo WHERE id IN (
+//  	SELECT id FROM foo WHERE deleted = 1 {limit}
+//  )`, 1000)
+// For MSSQL the marker becomes an OFFSET ... FETCH clause, which requires an
+// ORDER BY before it.
+//
+// Batches are not atomic: when given a *sql.DB every batch is committed on its
+// own, so a failure leaves the previous batches applied. When given a
+// transaction, all of them are committed along with it.
+func BatchExec(db DB, query string, batchSize int, args ...interface{}) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be greater than 0, got %d", batchSize)
+	}
+
+	if !strings.Contains(query, limitMarker) {
+		return fmt.Errorf("query must contain the %s marker", limitMarker)
+	}
+
+	query = strings.Replace(query, limitMarker, limitClause(dialectFor(db), batchSize), -1)
+	for {
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("unable to get the rows affected by batch: %s", err)
+		}
+
+		if affected == 0 {
+			return nil
+		}
+	}
+}
+
+// limitClause returns the clause to limit the rows returned by a query to n
+// for the given dialect.
+func limitClause(d Dialect, n int) string {
+	if d == MSSQL {
+		return fmt.Sprintf("OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", n)
+	}
+	return fmt.Sprintf("LIMIT %d", n)
+}
+
+// CopyTable is an utility function to copy all the rows of the table src into
+// the table dst, which must already exist. Only the given columns are copied or
+// all of them if none are given, in which case both tables must have the same
+// columns in the same order. It is meant to rewrite tables by creating a new
+// one, copying the rows and swapping them.
+//  CopyTable(db, `foo`, `foo_new`, []string{`id`, `name`})
+func CopyTable(db DB, src, dst string, columns []string) error {
+	d := dialectFor(db)
+
+	srcTable, err := quoteIdent(d, src)
+	if err != nil {
+		return err
+	}
+
+	dstTable, err := quoteIdent(d, dst)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", dstTable, srcTable)
+	if len(columns) > 0 {
+		cols := make([]string, len(columns))
+		for i, c := range columns {
+			if cols[i], err = quoteIdent(d, c); err != nil {
+				return err
+			}
+		}
+
+		list := strings.Join(cols, ", ")
+		query = fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", dstTable, list, list, srcTable)
+	}
+
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("unable to copy table %s into %s: %s", src, dst, err)
+	}
+	return nil
+}
+
+// RenameTable is an utility function to rename a table using the statement
+// the given dialect supports.
+//  RenameTable(db, mig.Postgres, `foo`, `bar`)
+func RenameTable(db DB, d Dialect, from, to string) error {
+	query, err := renameTableQuery(d, from, to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("unable to rename table %s to %s: %s", from, to, err)
+	}
+	return nil
+}
+
+func renameTableQuery(d Dialect, from, to string) (string, error) {
+	fromTable, err := quoteIdent(d, from)
+	if err != nil {
+		return "", err
+	}
+
+	toTable, err := quoteIdent(d, to)
+	if err != nil {
+		return "", err
+	}
+
+	switch d {
+	case MySQL:
+		return fmt.Sprintf("RENAME TABLE %s TO %s", fromTable, toTable), nil
+	case MSSQL:
+		// sp_rename takes the new name without schema
+		return fmt.Sprintf("EXEC sp_rename %s, %s", quoteString(from), quoteString(unqualified(to))), nil
+	case Postgres:
+		// the table can only be renamed in its own schema
+		toTable, _ = quoteIdent(d, unqualified(to))
+	}
+
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s", fromTable, toTable), nil
+}
+
+// unqualified returns the given identifier without the schema.
+func unqualified(name string) string {
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// AddColumn is an utility function to add a column of the given type to a
+// table using the statement the given dialect supports.
+//  AddColumn(db, mig.Postgres, `foo`, `bar`, `text not null default ''`)
+func AddColumn(db DB, d Dialect, table, column, typ string) error {
+	query, err := addColumnQuery(d, table, column, typ)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("unable to add column %s to table %s: %s", column, table, err)
+	}
+	return nil
+}
+
+func addColumnQuery(d Dialect, table, column, typ string) (string, error) {
+	t, err := quoteIdent(d, table)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := quoteIdent(d, column)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(typ) == "" || strings.Contains(typ, ";") {
+		return "", fmt.Errorf("invalid column type %q", typ)
+	}
+
+	if d == MSSQL {
+		return fmt.Sprintf("ALTER TABLE %s ADD %s %s", t, c, typ), nil
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t, c, typ), nil
+}
+
+// DropColumn is an utility function to drop a column of a table using the
+// statement the given dialect supports. SQLite versions older than 3.35 do
+// not support dropping columns, so the table is rebuilt without the column
+// instead. The rebuilt table keeps the type, nullability, default and primary
+// key of the columns, but not its indexes, triggers or other constraints, and
+// it should be done inside a transaction.
+func DropColumn(db DB, d Dialect, table, column string) error {
+	if d == SQLite {
+		ok, err := sqliteSupportsDropColumn(db)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return rebuildWithoutColumn(db, table, column)
+		}
+	}
+
+	t, err := quoteIdent(d, table)
+	if err != nil {
+		return err
+	}
+
+	c, err := quoteIdent(d, column)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t, c)
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("unable to drop column %s from table %s: %s", column, table, err)
+	}
+	return nil
+}
+
+// sqliteSupportsDropColumn reports whether the SQLite version of the database
+// is 3.35 or newer.
+func sqliteSupportsDropColumn(db DB) (bool, error) {
+	var version string
+	if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return false, fmt.Errorf("unable to get sqlite version: %s", err)
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return false, fmt.Errorf("unexpected sqlite version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false, fmt.Errorf("unexpected sqlite version %q", version)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false, fmt.Errorf("unexpected sqlite version %q", version)
+	}
+
+	return major > 3 || (major == 3 && minor >= 35), nil
+}
+
+// rebuildWithoutColumn drops a column of a SQLite table by creating a new
+// table without it, copying all the rows and replacing the old table.
+func rebuildWithoutColumn(db DB, table, column string) error {
+	t, err := quoteIdent(SQLite, table)
+	if err != nil {
+		return err
+	}
+
+	if _, err := quoteIdent(SQLite, column); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", t))
+	if err != nil {
+		return fmt.Errorf("unable to get columns of table %s: %s", table, err)
+	}
+	defer rows.Close()
+
+	var (
+		defs    []string
+		columns []string
+		pks     []string
+		found   bool
+	)
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull bool
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("unable to scan columns of table %s: %s", table, err)
+		}
+
+		if name == column {
+			found = true
+			continue
+		}
+
+		def := fmt.Sprintf(`"%s" %s`, name, typ)
+		if notNull {
+			def += " NOT NULL"
+		}
+		if dflt.Valid {
+			def += " DEFAULT " + dflt.String
+		}
+
+		defs = append(defs, def)
+		columns = append(columns, name)
+		if pk > 0 {
+			pks = append(pks, fmt.Sprintf(`"%s"`, name))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("unable to read columns of table %s: %s", table, err)
+	}
+	rows.Close()
+
+	if !found {
+		return fmt.Errorf("column %s does not exist in table %s", column, table)
+	}
+
+	if len(pks) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pks, ", ")))
+	}
+
+	tmp := table + "_mig_rebuild"
+	err = ExecAll(db, fmt.Sprintf(`CREATE TABLE "%s" (%s)`, tmp, strings.Join(defs, ", ")))
+	if err != nil {
+		return fmt.Errorf("unable to create table to rebuild %s: %s", table, err)
+	}
+
+	if err := CopyTable(db, table, tmp, columns); err != nil {
+		return err
+	}
+
+	if err := DropAll(db, t); err != nil {
+		return fmt.Errorf("unable to drop table %s: %s", table, err)
+	}
+
+	return RenameTable(db, SQLite, tmp, table)
+}
+
+// BackupTable is an utility function to copy all the rows of a table into a
+// new table named after it with a _backup_<timestamp> suffix, which is
+// returned, before making a destructive change to it. If a table with that
+// name already exists, e.g. because the table was backed up in the same
+// second, a _<n> suffix is added to the name. The backup only keeps
+// the columns and rows of the table, not its indexes or constraints. It is
+// meant to be used with RestoreTable in the down of the migration to make the
+// change reversible.
+//  backup, err := BackupTable(db, `users`)
+func BackupTable(db DB, table string) (backupName string, err error) {
+	d := dialectFor(db)
+	base := fmt.Sprintf("%s_backup_%d", table, time.Now().Unix())
+	backupName = base
+	for n := 2; ; n++ {
+		var count int
+		if err := db.QueryRow(tableExistsQuery(d, backupName), execModeArgs()...).Scan(&count); err != nil {
+			return "", fmt.Errorf("unable to back up table %s: %s", table, err)
+		}
+
+		if count == 0 {
+			break
+		}
+		backupName = fmt.Sprintf("%s_%d", base, n)
+	}
+
+	query, err := backupTableQuery(d, table, backupName)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := db.Exec(query); err != nil {
+		return "", fmt.Errorf("unable to back up table %s: %s", table, err)
+	}
+	return backupName, nil
+}
+
+func backupTableQuery(d Dialect, table, backup string) (string, error) {
+	t, err := quoteIdent(d, table)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := quoteIdent(d, backup)
+	if err != nil {
+		return "", err
+	}
+
+	if d == MSSQL {
+		return fmt.Sprintf("SELECT * INTO %s FROM %s", b, t), nil
+	}
+	return fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", b, t), nil
+}
+
+// RestoreTable is an utility function to replace all the rows of a table with
+// the ones of a backup created with BackupTable, dropping the backup
+// afterwards. The table must exist and have the same columns in the same
+// order as the backup, so any column dropped since the backup was made must
+// be added back before restoring it. It should be done inside a transaction.
+//  RestoreTable(db, backup, `users`)
+func RestoreTable(db DB, backupName, table string) error {
+	d := dialectFor(db)
+	t, err := quoteIdent(d, table)
+	if err != nil {
+		return err
+	}
+
+	b, err := quoteIdent(d, backupName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s", t)); err != nil {
+		return fmt.Errorf("unable to delete rows of table %s: %s", table, err)
+	}
+
+	if err := CopyTable(db, backupName, table, nil); err != nil {
+		return err
+	}
+
+	if err := DropAll(db, b); err != nil {
+		return fmt.Errorf("unable to drop backup table %s: %s", backupName, err)
+	}
+	return nil
+}
+
+// encryptBatchSize is the number of rows read and written back at once by
+// EncryptColumn.
+var encryptBatchSize = 1000
+
+// EncryptColumn is an utility function to transform all the non-null values
+// of a column, e.g. to encrypt them with a key only the application has. The
+// rows are read in batches ordered by the primary key of the table, which
+// must be made of a single column, and every one of them is updated by its key,
+// so each value is transformed exactly once even if enc returns a value that
+// is also an original value of the column. In SQLite the rowid is used
+// instead. Like BatchExec, it is not atomic unless it is given a transaction.
+//  EncryptColumn(db, `users`, `ssn`, func(v []byte) ([]byte, error) {
+//  	return encrypt(key, v)
+//  })
+func EncryptColumn(db DB, table, column string, enc func([]byte) ([]byte, error)) error {
+	d := dialectFor(db)
+	t, err := quoteIdent(d, table)
+	if err != nil {
+		return err
+	}
+
+	c, err := quoteIdent(d, column)
+	if err != nil {
+		return err
+	}
+
+	key, err := primaryKey(db, d, table)
+	if err != nil {
+		return err
+	}
+
+	update := fmt.Sprintf(
+		"UPDATE %s SET %s = %s WHERE %s = %s",
+		t, c, placeholder(d, 1), key, placeholder(d, 2),
+	)
+
+	var last interface{}
+	for {
+		batch, err := nextBatch(db, d, t, key, c, last)
+		if err != nil {
+			return fmt.Errorf("unable to read column %s of table %s: %s", column, table, err)
+		}
+
+		for _, r := range batch {
+			var (
+				transformed []byte
+				err         error
+			)
+			switch v := r.value.(type) {
+			case []byte:
+				transformed, err = enc(v)
+			case string:
+				transformed, err = enc([]byte(v))
+			default:
+				transformed, err = enc([]byte(fmt.Sprint(v)))
+			}
+
+			if err != nil {
+				return fmt.Errorf("unable to transform value of column %s: %s", column, err)
+			}
+
+			// the new value is written with the same type as the original,
+			// so text columns are not turned into binary ones
+			var newValue interface{} = transformed
+			if _, ok := r.value.([]byte); !ok {
+				newValue = string(transformed)
+			}
+
+			if _, err := db.Exec(update, newValue, r.key); err != nil {
+				return fmt.Errorf("unable to update column %s of table %s: %s", column, table, err)
+			}
+		}
+
+		if len(batch) < encryptBatchSize {
+			return nil
+		}
+		last = batch[len(batch)-1].key
+	}
+}
+
+type keyedValue struct {
+	key   interface{}
+	value interface{}
+}
+
+// nextBatch returns the next batch of non-null values of the given column
+// with the key of their rows, starting after the row with the given key, or
+// from the first one if it's nil.
+func nextBatch(db DB, d Dialect, table, key, column string, after interface{}) ([]keyedValue, error) {
+	var args []interface{}
+	where := fmt.Sprintf("%s IS NOT NULL", column)
+	if after != nil {
+		where += fmt.Sprintf(" AND %s > %s", key, placeholder(d, 1))
+		args = append(args, after)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT %s, %s FROM %s WHERE %s ORDER BY %s %s",
+		key, column, table, where, key, limitClause(d, encryptBatchSize),
+	), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []keyedValue
+	for rows.Next() {
+		var r keyedValue
+		if err := rows.Scan(&r.key, &r.value); err != nil {
+			return nil, err
+		}
+		batch = append(batch, r)
+	}
+
+	return batch, rows.Err()
+}
+
+// primaryKey returns the quoted column of the primary key of the given table,
+// or the rowid in SQLite.
+func primaryKey(db DB, d Dialect, table string) (string, error) {
+	if d == SQLite {
+		return "rowid", nil
+	}
+
+	rows, err := db.Query(primaryKeyQuery(d, table), execModeArgs()...)
+	if err != nil {
+		return "", fmt.Errorf("unable to get primary key of table %s: %s", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return "", fmt.Errorf("unable to get primary key of table %s: %s", table, err)
+		}
+		columns = append(columns, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("unable to get primary key of table %s: %s", table, err)
+	}
+
+	if len(columns) != 1 {
+		return "", fmt.Errorf("table %s must have a primary key made of a single column, it has %d columns", table, len(columns))
+	}
+
+	return quoteIdent(d, columns[0])
+}
@@ -0,0 +1,551 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecFile(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	f, err := ioutil.TempFile(os.TempDir(), "test-mig-*.sql")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`-- schema; with semicolons
+CREATE TABLE foo (id integer, name text);
+INSERT INTO foo (id, name) VALUES (1, 'a;b');
+INSERT INTO foo (id, name) VALUES (2, 'c');
+`)
+	f.Close()
+	if err != nil {
+		t.Fatalf("unexpected error writing temp file: %s", err)
+	}
+
+	if err := ExecFile(db, f.Name()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var name string
+	if err := db.QueryRow(`SELECT name FROM foo WHERE id = 1`).Scan(&name); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if name != "a;b" {
+		t.Errorf("unexpected name:\n\t(GOT): %s\n\t(WNT): %s", name, "a;b")
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM foo`).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 2 {
+		t.Errorf("unexpected rows:\n\t(GOT): %d\n\t(WNT): %d", count, 2)
+	}
+}
+
+func TestExecFile_Errors(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if err := ExecFile(db, filepath.Join(os.TempDir(), "mig-does-not-exist.sql")); err == nil {
+		t.Errorf("expecting error with missing file")
+	}
+
+	f, err := ioutil.TempFile(os.TempDir(), "test-mig-*.sql")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("CREATE TABLE foo (id integer);\nINSERT INTO bar (id) VALUES (1);\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("unexpected error writing temp file: %s", err)
+	}
+
+	err = ExecFile(db, f.Name())
+	if err == nil {
+		t.Fatalf("expecting error with invalid statement")
+	}
+
+	if !strings.Contains(err.Error(), "statement 2") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestBatchExec(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE items (id integer primary key, done integer)`,
+		`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 25)
+		INSERT INTO items (id, done) SELECT n, 0 FROM seq`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = BatchExec(db, `UPDATE items SET done = ? WHERE id IN (
+		SELECT id FROM items WHERE done = 0 {limit}
+	)`, 10, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items WHERE done = 0`).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 0 {
+		t.Errorf("unexpected pending rows:\n\t(GOT): %d\n\t(WNT): %d", count, 0)
+	}
+}
+
+func TestBatchExec_Invalid(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if err := BatchExec(db, `DELETE FROM foo {limit}`, 0); err == nil {
+		t.Errorf("expecting error with invalid batch size")
+	}
+
+	if err := BatchExec(db, `DELETE FROM foo`, 10); err == nil {
+		t.Errorf("expecting error without limit marker")
+	}
+}
+
+func TestCopyTable(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE foo (id integer, name text, extra text)`,
+		`CREATE TABLE foo_all (id integer, name text, extra text)`,
+		`CREATE TABLE foo_cols (id integer, name text)`,
+		`INSERT INTO foo VALUES (1, 'a', 'x'), (2, 'b', 'y')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := CopyTable(db, "foo", "foo_all", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := CopyTable(db, "foo", "foo_cols", []string{"id", "name"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, table := range []string{"foo_all", "foo_cols"} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE name IN ('a', 'b')`).Scan(&count); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if count != 2 {
+			t.Errorf("unexpected rows in %s:\n\t(GOT): %d\n\t(WNT): %d", table, count, 2)
+		}
+	}
+}
+
+func TestCopyTable_InvalidIdentifiers(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	cases := []struct {
+		src, dst string
+		columns  []string
+	}{
+		{"foo; DROP TABLE bar", "baz", nil},
+		{"foo", "baz\"", nil},
+		{"foo", "baz", []string{"id", "na me"}},
+	}
+
+	for _, c := range cases {
+		if err := CopyTable(db, c.src, c.dst, c.columns); err == nil {
+			t.Errorf("expecting error copying %q into %q with columns %v", c.src, c.dst, c.columns)
+		}
+	}
+}
+
+func TestBackupTableQuery(t *testing.T) {
+	testCases := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{Postgres, `CREATE TABLE "foo_backup_1" AS SELECT * FROM "foo"`},
+		{SQLite, `CREATE TABLE "foo_backup_1" AS SELECT * FROM "foo"`},
+		{MySQL, "CREATE TABLE `foo_backup_1` AS SELECT * FROM `foo`"},
+		{MSSQL, `SELECT * INTO "foo_backup_1" FROM "foo"`},
+	}
+
+	for _, tt := range testCases {
+		query, err := backupTableQuery(tt.dialect, "foo", "foo_backup_1")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if query != tt.expected {
+			t.Errorf("unexpected query for %s:\n\t(GOT): %s\n\t(WNT): %s", tt.dialect, query, tt.expected)
+		}
+	}
+}
+
+func TestBackupTable_SameSecond(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE foo (id integer primary key, name text)`,
+		`INSERT INTO foo VALUES (1, 'a')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	first, err := BackupTable(db, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := ExecAll(db, `UPDATE foo SET name = 'b'`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	second, err := BackupTable(db, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if first == second {
+		t.Fatalf("expecting different backup names, got %s twice", first)
+	}
+
+	for backup, expected := range map[string]string{first: "a", second: "b"} {
+		var name string
+		if err := db.QueryRow(fmt.Sprintf(`SELECT name FROM %q`, backup)).Scan(&name); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if name != expected {
+			t.Errorf("unexpected name in backup %s:\n\t(GOT): %s\n\t(WNT): %s", backup, name, expected)
+		}
+	}
+}
+
+func TestBackupRestoreTable(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE foo (id integer primary key, name text)`,
+		`INSERT INTO foo VALUES (1, 'a'), (2, 'b')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	backup, err := BackupTable(db, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(backup, "foo_backup_") {
+		t.Errorf("unexpected backup name: %s", backup)
+	}
+
+	if err := ExecAll(db, `DELETE FROM foo WHERE id = 1`, `UPDATE foo SET name = 'c'`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RestoreTable(db, backup, "foo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var names []string
+	rows, err := db.Query(`SELECT name FROM foo ORDER BY id`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		names = append(names, name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("unexpected rows:\n\t(GOT): %v\n\t(WNT): %v", names, []string{"a", "b"})
+	}
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, backup).Scan(&count)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 0 {
+		t.Errorf("expecting backup table %s to be dropped", backup)
+	}
+}
+
+func TestRenameTableQuery(t *testing.T) {
+	testCases := []struct {
+		dialect  Dialect
+		from, to string
+		expected string
+	}{
+		{Postgres, "foo", "bar", `ALTER TABLE "foo" RENAME TO "bar"`},
+		{Postgres, "public.foo", "public.bar", `ALTER TABLE "public"."foo" RENAME TO "bar"`},
+		{SQLite, "foo", "bar", `ALTER TABLE "foo" RENAME TO "bar"`},
+		{MySQL, "foo", "bar", "RENAME TABLE `foo` TO `bar`"},
+		{MSSQL, "dbo.foo", "dbo.bar", `EXEC sp_rename 'dbo.foo', 'bar'`},
+	}
+
+	for _, tt := range testCases {
+		query, err := renameTableQuery(tt.dialect, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if query != tt.expected {
+			t.Errorf("unexpected query for %s:\n\t(GOT): %s\n\t(WNT): %s", tt.dialect, query, tt.expected)
+		}
+	}
+
+	if _, err := renameTableQuery(MSSQL, "foo'", "bar"); err == nil {
+		t.Errorf("expecting error with invalid identifier")
+	}
+}
+
+func TestRenameTable(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	if err := ExecAll(db, `CREATE TABLE foo (id integer)`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := RenameTable(db, SQLite, "foo", "bar"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := db.Exec(`SELECT id FROM bar`); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestAddColumnQuery(t *testing.T) {
+	testCases := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{Postgres, `ALTER TABLE "foo" ADD COLUMN "bar" text not null default ''`},
+		{SQLite, `ALTER TABLE "foo" ADD COLUMN "bar" text not null default ''`},
+		{MySQL, "ALTER TABLE `foo` ADD COLUMN `bar` text not null default ''"},
+		{MSSQL, `ALTER TABLE "foo" ADD "bar" text not null default ''`},
+	}
+
+	for _, tt := range testCases {
+		query, err := addColumnQuery(tt.dialect, "foo", "bar", "text not null default ''")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if query != tt.expected {
+			t.Errorf("unexpected query for %s:\n\t(GOT): %s\n\t(WNT): %s", tt.dialect, query, tt.expected)
+		}
+	}
+
+	if _, err := addColumnQuery(Postgres, "foo", "bar", "text; DROP TABLE foo"); err == nil {
+		t.Errorf("expecting error with invalid type")
+	}
+}
+
+func TestAddDropColumn(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE foo (id integer primary key, name text not null default 'x')`,
+		`INSERT INTO foo (id) VALUES (1), (2)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := AddColumn(db, SQLite, "foo", "extra", "integer"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := DropColumn(db, SQLite, "foo", "extra"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := db.Exec(`SELECT extra FROM foo`); err == nil {
+		t.Errorf("expecting column extra to be dropped")
+	}
+}
+
+func TestRebuildWithoutColumn(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE foo (id integer primary key, name text not null default 'x', extra integer)`,
+		`INSERT INTO foo (id, extra) VALUES (1, 10), (2, 20)`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := rebuildWithoutColumn(db, "foo", "extra"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := db.Exec(`SELECT extra FROM foo`); err == nil {
+		t.Errorf("expecting column extra to be dropped")
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM foo WHERE name = 'x'`).Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if count != 2 {
+		t.Errorf("unexpected rows:\n\t(GOT): %d\n\t(WNT): %d", count, 2)
+	}
+
+	if _, err := db.Exec(`INSERT INTO foo (id) VALUES (1)`); err == nil {
+		t.Errorf("expecting primary key to be kept")
+	}
+
+	if err := rebuildWithoutColumn(db, "foo", "missing"); err == nil {
+		t.Errorf("expecting error with missing column")
+	}
+}
+
+func TestEncryptColumn(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE users (id integer, secret blob)`,
+		`INSERT INTO users VALUES (1, 'foo'), (2, 'bar'), (3, 'foo'), (4, NULL), (5, X'626c6f62')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = EncryptColumn(db, "users", "secret", func(v []byte) ([]byte, error) {
+		return append([]byte("enc:"), v...), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := db.Query(`SELECT secret FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result = append(result, v.String)
+	}
+
+	expected := []string{"enc:foo", "enc:bar", "enc:foo", "", "enc:blob"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, expected)
+	}
+}
+
+func TestEncryptColumn_Collision(t *testing.T) {
+	defer func(n int) { encryptBatchSize = n }(encryptBatchSize)
+	encryptBatchSize = 2
+
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE users (id integer, secret text)`,
+		`INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'a'), (5, 'd')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the output of every value is the input of the next one, so values
+	// would be transformed more than once if rows were updated by value
+	next := map[string]string{"a": "b", "b": "c", "c": "d", "d": "e"}
+	err = EncryptColumn(db, "users", "secret", func(v []byte) ([]byte, error) {
+		return []byte(next[string(v)]), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := db.Query(`SELECT secret FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result = append(result, v)
+	}
+
+	expected := []string{"b", "c", "d", "b", "e"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result:\n\t(GOT): %v\n\t(WNT): %v", result, expected)
+	}
+}
+
+func TestPrimaryKeyQuery(t *testing.T) {
+	for _, d := range []Dialect{Postgres, MySQL, MSSQL} {
+		query := primaryKeyQuery(d, "users")
+		if !strings.Contains(query, "tc.table_name = 'users'") || !strings.Contains(query, "'PRIMARY KEY'") {
+			t.Errorf("unexpected query for %s: %s", d, query)
+		}
+	}
+}
+
+func TestEncryptColumn_Error(t *testing.T) {
+	db, cleanup := initTest(t, 0)
+	defer cleanup()
+
+	err := ExecAll(db,
+		`CREATE TABLE users (id integer, secret blob)`,
+		`INSERT INTO users VALUES (1, 'foo')`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = EncryptColumn(db, "users", "secret", func(v []byte) ([]byte, error) {
+		return nil, fmt.Errorf("can't encrypt")
+	})
+	if err == nil {
+		t.Errorf("expecting error")
+	}
+}
@@ -0,0 +1,86 @@
+package mig
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+var sqlValidator func(stmt string) error
+
+// SetSQLValidator sets the function used by ValidateSQL to validate the
+// statements of the migrations loaded from SQL files for dialects other than
+// SQLite, e.g. a parser of the SQL dialect of the database.
+func SetSQLValidator(fn func(stmt string) error) {
+	sqlValidator = fn
+}
+
+// ValidateSQL validates the statements of all the migrations loaded from SQL
+// files without needing a database, so obvious errors such as typos can be
+// caught before deploying. It is a best effort validation, a statement being
+// valid does not mean it will succeed against the real database.
+//
+// For SQLite, the up statements of every migration are run in order followed
+// by the down statements in reverse order against an in-memory database,
+// which requires the github.com/mattn/go-sqlite3 driver to be imported. For
+// the rest of dialects, every statement is given to the function set with
+// SetSQLValidator.
+//
+// All the errors found are returned, each one of them saying which migration
+// and statement failed. Migrations written in Go are ignored.
+func ValidateSQL(d Dialect) []error {
+	if d == SQLite {
+		return validateSQLite()
+	}
+
+	if sqlValidator == nil {
+		return []error{fmt.Errorf("there is no SQL validator for dialect %s, set one with SetSQLValidator", d)}
+	}
+
+	return validateStatements(func(stmt string) error {
+		return sqlValidator(stmt)
+	})
+}
+
+func validateSQLite() []error {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return []error{fmt.Errorf("unable to open in-memory sqlite database, make sure the sqlite3 driver is imported: %s", err)}
+	}
+	defer db.Close()
+
+	// every connection to an in-memory database is a different database
+	db.SetMaxOpenConns(1)
+
+	return validateStatements(func(stmt string) error {
+		_, err := db.Exec(stmt)
+		return err
+	})
+}
+
+// validateStatements calls validate with the up statements of every SQL
+// migration in order and then with their down statements in reverse order,
+// returning all the errors.
+func validateStatements(validate func(stmt string) error) []error {
+	var errs []error
+	check := func(m migration, direction string, stmts []string) {
+		for i, stmt := range stmts {
+			if err := validate(stmt); err != nil {
+				errs = append(errs, fmt.Errorf(
+					"migration %d (%s), %s statement %d: %s",
+					m.version, m.file, direction, i+1, err,
+				))
+			}
+		}
+	}
+
+	sorted := sortedMigrations()
+	for _, m := range sorted {
+		check(m, "up", m.upSQL)
+	}
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		check(sorted[i], "down", sorted[i].downSQL)
+	}
+
+	return errs
+}
@@ -0,0 +1,71 @@
+package mig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestValidateSQL_SQLite(t *testing.T) {
+	defer reset()
+
+	err := LoadSQLFS(fstest.MapFS{
+		"0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id integer);\nINSERT INTO users (id) VALUES (1);")},
+		"0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_posts.up.sql":   {Data: []byte("CREAT TABLE posts (id integer);")},
+		"0002_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	errs := ValidateSQL(SQLite)
+	if len(errs) != 2 {
+		t.Fatalf("unexpected number of errors:\n\t(GOT): %d\n\t(WNT): %d\n%v", len(errs), 2, errs)
+	}
+
+	for i, expected := range []string{
+		"migration 2 (0002_posts.up.sql), up statement 1",
+		"migration 2 (0002_posts.up.sql), down statement 1",
+	} {
+		if !strings.HasPrefix(errs[i].Error(), expected) {
+			t.Errorf("unexpected error:\n\t(GOT): %s\n\t(WNT): %s...", errs[i], expected)
+		}
+	}
+}
+
+func TestValidateSQL_Validator(t *testing.T) {
+	defer reset()
+	defer SetSQLValidator(nil)
+
+	err := LoadSQLFS(fstest.MapFS{
+		"0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id serial)")},
+		"0001_users.down.sql": {Data: []byte("DROP TABLE users")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if errs := ValidateSQL(Postgres); len(errs) != 1 {
+		t.Errorf("expecting an error because there is no validator, got %v", errs)
+	}
+
+	var validated []string
+	SetSQLValidator(func(stmt string) error {
+		validated = append(validated, stmt)
+		if strings.HasPrefix(stmt, "DROP") {
+			return errors.New("not allowed")
+		}
+		return nil
+	})
+
+	errs := ValidateSQL(Postgres)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "down statement 1: not allowed") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	if len(validated) != 2 {
+		t.Errorf("unexpected number of validated statements:\n\t(GOT): %d\n\t(WNT): %d", len(validated), 2)
+	}
+}
@@ -0,0 +1,63 @@
+package mig
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Warning is a message recorded by a migration that did not make it fail but
+// is worth being reported, e.g. "skipped 3 malformed rows".
+type Warning struct {
+	// Version of the migration that recorded the warning.
+	Version int64
+	// Message of the warning.
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("migration %d: %s", w.Version, w.Message)
+}
+
+var warnings = new(warningCollector)
+
+// Warn records a warning for the migration that is currently being run. It is
+// meant to be called from inside migration functions. Warnings recorded during
+// a run can be retrieved afterwards using Warnings.
+func Warn(format string, args ...interface{}) {
+	warnings.add(fmt.Sprintf(format, args...))
+}
+
+// Warnings returns the warnings recorded by the migrations during the last run.
+func Warnings() []Warning {
+	warnings.mut.Lock()
+	defer warnings.mut.Unlock()
+
+	var result = make([]Warning, len(warnings.list))
+	copy(result, warnings.list)
+	return result
+}
+
+type warningCollector struct {
+	mut     sync.Mutex
+	version int64
+	list    []Warning
+}
+
+func (c *warningCollector) reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.version = 0
+	c.list = nil
+}
+
+func (c *warningCollector) setVersion(v int64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.version = v
+}
+
+func (c *warningCollector) add(msg string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.list = append(c.list, Warning{c.version, msg})
+}